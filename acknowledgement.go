@@ -0,0 +1,43 @@
+package rabbitmq
+
+import (
+	"errors"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+type Acknowledgement int
+
+const (
+	ACK          Acknowledgement = iota
+	NACK_REQUEUE                 // return to the queue
+	REJECT                       // drop or dead-letter when queue has x-dead-letter-exchange
+)
+
+// AckPolicy maps processing outcome to the delivery acknowledgement
+type AckPolicy func(msg amqp091.Delivery, e error) Acknowledgement
+
+// DefaultAckPolicy acknowledges processed messages, requeues failed
+// processing once and dead-letters unprocessable, unparsable
+// and repeatedly failed messages
+func DefaultAckPolicy(msg amqp091.Delivery, e error) Acknowledgement {
+	switch {
+	case e == nil, errors.Is(e, ErrorProcessingDuration):
+		return ACK
+	case errors.Is(e, ErrorProcessingFailed) && !msg.Redelivered:
+		return NACK_REQUEUE
+	default:
+		return REJECT
+	}
+}
+
+func acknowledge(msg amqp091.Delivery, ack Acknowledgement) error {
+	switch ack {
+	case NACK_REQUEUE:
+		return msg.Nack(false, true)
+	case REJECT:
+		return msg.Reject(false)
+	default:
+		return msg.Ack(false) // non-multiple acknowledgement
+	}
+}
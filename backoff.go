@@ -0,0 +1,39 @@
+package rabbitmq
+
+import (
+	"time"
+)
+
+type backoff struct {
+	min        time.Duration
+	max        time.Duration
+	multiplier float64
+}
+
+func newBackoff(min, max string, multiplier float64) (backoff, error) {
+	b := backoff{multiplier: multiplier}
+
+	var e error
+	if b.min, e = time.ParseDuration(min); e != nil {
+		return b, e
+	}
+	if b.max, e = time.ParseDuration(max); e != nil {
+		return b, e
+	}
+	if b.multiplier < 1 {
+		b.multiplier = 1
+	}
+	return b, nil
+}
+
+// delay for attempt starting from 1: min, min*multiplier, ... up to max
+func (this backoff) delay(attempt int) time.Duration {
+	d := float64(this.min)
+	for i := 1; i < attempt && d < float64(this.max); i++ {
+		d *= this.multiplier
+	}
+	if this.max > 0 && d > float64(this.max) {
+		return this.max
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,211 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BatchMessage struct {
+	Body    []byte
+	Options []PublishOption
+}
+
+// BatchError reports failed messages by their position in batch
+type BatchError struct {
+	Failures map[int]error
+}
+
+func (this *BatchError) Error() string {
+	positions := make([]int, 0, len(this.Failures))
+	for pos := range this.Failures {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+
+	failures := make([]string, len(positions))
+	for i, pos := range positions {
+		failures[i] = fmt.Sprintf("#%d: %s", pos, this.Failures[pos])
+	}
+	return fmt.Sprintf("%d messages failed: %s", len(failures), strings.Join(failures, "; "))
+}
+
+func (this *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(this.Failures))
+	for _, e := range this.Failures {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// PublishBatch writes messages by ConfigBatch.MaxSize chunks and waits for
+// all confirms of a chunk at once, failed messages are reported by BatchError.
+// Publisher must be in confirm mode, otherwise ErrorConfirmRequired
+func (this *Publisher) PublishBatch(ctx context.Context, messages ...BatchMessage) error {
+	if !this.configPublisher.Confirm {
+		return ErrorConfirmRequired
+	}
+	return this.publishBatch(ctx, batchSize(this.configBatch), messages)
+}
+
+func (this *Publisher) publishBatch(ctx context.Context, size int, messages []BatchMessage) error {
+	failures := map[int]error{}
+	for start := 0; start < len(messages); start += size {
+		end := start + size
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		confirmations := make([]*Confirmation, end-start)
+		for i := start; i < end; i++ {
+			confirmation, e := this.publish(ctx, messages[i].Body, messages[i].Options)
+			if e != nil {
+				failures[i] = e
+				continue
+			}
+			confirmations[i-start] = confirmation
+		}
+
+		confirmCtx, cancel, ctxError := this.confirmContext(ctx)
+		if ctxError != nil {
+			return ctxError
+		}
+		for i, confirmation := range confirmations {
+			if confirmation == nil {
+				continue
+			}
+			if e := waitConfirmation(ctx, confirmCtx, confirmation); e != nil {
+				failures[start+i] = e
+			}
+		}
+		cancel()
+	}
+
+	if len(failures) > 0 {
+		return &BatchError{Failures: failures}
+	}
+	return nil
+}
+
+func batchSize(cfg ConfigBatch) int {
+	if cfg.MaxSize <= 0 {
+		return DefaultConfigBatch.MaxSize
+	}
+	return cfg.MaxSize
+}
+
+// NewBatcher starts background batching: added messages are published by
+// chunks of ConfigBatch.MaxSize when it is reached or each FlushInterval,
+// cfg replaces ConfigBatch of publisher for batcher messages
+func NewBatcher(publisher *Publisher, cfg ConfigBatch) (*Batcher, error) {
+	if !publisher.configPublisher.Confirm {
+		return nil, ErrorConfirmRequired
+	}
+	interval, intervalError := time.ParseDuration(cfg.FlushInterval)
+	if intervalError != nil {
+		return nil, intervalError
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: flush interval %s", ErrorInvalidInterval, cfg.FlushInterval)
+	}
+	b := &Batcher{
+		publisher: publisher,
+		size: batchSize(cfg),
+		full: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go b.loop(time.NewTicker(interval))
+	return b, nil
+}
+
+type Batcher struct {
+	publisher *Publisher
+	size      int
+
+	mx        sync.Mutex
+	messages  []BatchMessage
+	handles   []*Confirmation
+	closed    bool
+
+	full      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// Add queues message, returned handle is resolved after flush
+func (this *Batcher) Add(body []byte, opts ...PublishOption) *Confirmation {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+
+	if this.closed {
+		return resolvedConfirmation(ErrorBatcherClosed)
+	}
+
+	handle := newConfirmation(0)
+	this.messages = append(this.messages, BatchMessage{Body: body, Options: opts})
+	this.handles = append(this.handles, handle)
+
+	if len(this.messages) >= this.size {
+		select {
+		case this.full <- struct{}{}:
+		default:
+		}
+	}
+	return handle
+}
+
+// Flush publishes queued messages synchronously
+func (this *Batcher) Flush(ctx context.Context) error {
+	this.mx.Lock()
+	messages, handles := this.messages, this.handles
+	this.messages, this.handles = nil, nil
+	this.mx.Unlock()
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	e := this.publisher.publishBatch(ctx, this.size, messages)
+	batchError, _ := e.(*BatchError)
+	for i, handle := range handles {
+		if batchError != nil {
+			handle.resolve(batchError.Failures[i])
+			continue
+		}
+		handle.resolve(e)
+	}
+	return e
+}
+
+// Close stops background flushing and flushes remaining messages
+func (this *Batcher) Close(ctx context.Context) error {
+	this.mx.Lock()
+	if this.closed {
+		this.mx.Unlock()
+		return nil
+	}
+	this.closed = true
+	this.mx.Unlock()
+
+	close(this.stop)
+	<-this.done
+	return this.Flush(ctx)
+}
+
+func (this *Batcher) loop(ticker *time.Ticker) {
+	defer close(this.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-this.full:
+		case <-this.stop:
+			return
+		}
+		this.Flush(context.Background())
+	}
+}
@@ -0,0 +1,101 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fvaleriy89/rabbitmq/rabbitmqtest"
+)
+
+func TestPublishBatch(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	if e := publisher.PublishBatch(context.Background(), BatchMessage{Body: []byte("1")}); !errors.Is(e, ErrorConfirmRequired) {
+		t.Errorf("Expect ErrorConfirmRequired, got %v", e)
+	}
+
+	publisher.ConfigPublisher(ConfigPublisher{
+		Exchange: "events",
+		Mandatory: true,
+		Confirm: true,
+		ConfirmTimeout: "1s",
+	}).ConfigBatch(ConfigBatch{MaxSize: 2})
+
+	messages := make([]BatchMessage, 5)
+	for i := range messages {
+		key := "user.created"
+		if i == 3 {
+			key = "order.created"
+		}
+		messages[i] = BatchMessage{Body: []byte(fmt.Sprint(i)), Options: []PublishOption{PubRoutingKey(key)}}
+	}
+
+	e := publisher.PublishBatch(context.Background(), messages...)
+	var batchError *BatchError
+	if !errors.As(e, &batchError) {
+		t.Fatalf("Expect BatchError, got %v", e)
+	}
+	if len(batchError.Failures) != 1 || !errors.Is(batchError.Failures[3], ErrorUnroutable) {
+		t.Errorf("Expect unroutable message #3, got %s", batchError)
+	}
+	if published := broker.Messages("users"); len(published) != 4 {
+		t.Errorf("Expect 4 published messages, got %d", len(published))
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	if _, e := NewBatcher(NewPublisher(), DefaultConfigBatch); !errors.Is(e, ErrorConfirmRequired) {
+		t.Errorf("Expect ErrorConfirmRequired, got %v", e)
+	}
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{
+		Exchange: "events",
+		RoutingKey: "user.created",
+		Mandatory: true,
+		Confirm: true,
+		ConfirmTimeout: "1s",
+	})
+	if _, e := NewBatcher(publisher, ConfigBatch{MaxSize: 2, FlushInterval: "0s"}); !errors.Is(e, ErrorInvalidInterval) {
+		t.Errorf("Expect ErrorInvalidInterval, got %v", e)
+	}
+
+	batcher, e := NewBatcher(publisher, ConfigBatch{MaxSize: 2, FlushInterval: "1h"})
+	if e != nil {
+		t.Fatalf("Unexpected batcher error: %s", e)
+	}
+
+	// full batch is flushed without waiting for interval
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	first := batcher.Add([]byte("1"))
+	unroutable := batcher.Add([]byte("2"), PubRoutingKey("order.created"))
+	if e := first.Wait(ctx); e != nil {
+		t.Errorf("Unexpected confirmation error: %s", e)
+	}
+	if e := unroutable.Wait(ctx); !errors.Is(e, ErrorUnroutable) {
+		t.Errorf("Expect ErrorUnroutable, got %v", e)
+	}
+
+	// remaining messages are flushed on Close
+	last := batcher.Add([]byte("3"))
+	if e := batcher.Close(ctx); e != nil {
+		t.Errorf("Unexpected close error: %s", e)
+	}
+	if e := last.Err(); e != nil {
+		t.Errorf("Expect last message to be confirmed on close, got %v", e)
+	}
+	if e := batcher.Add([]byte("4")).Err(); !errors.Is(e, ErrorBatcherClosed) {
+		t.Errorf("Expect ErrorBatcherClosed, got %v", e)
+	}
+	if published := broker.Messages("users"); len(published) != 2 {
+		t.Errorf("Expect 2 published messages, got %d", len(published))
+	}
+}
@@ -20,7 +20,8 @@ type Binding struct {
 	configBinding    ConfigBinding
 
 	connection       *Connection
-	channel          *amqp091.Channel
+	channel          AMQPChannel
+	declared         bool
 }
 
 
@@ -39,7 +40,7 @@ func (this *Binding) SetConnection(connection *Connection) *Binding {
 	return this
 }
 
-func (this *Binding) SetChannel(channel *amqp091.Channel) *Binding {
+func (this *Binding) SetChannel(channel AMQPChannel) *Binding {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	this.channel = channel
@@ -47,6 +48,10 @@ func (this *Binding) SetChannel(channel *amqp091.Channel) *Binding {
 }
 
 func (this *Binding) Channel() (*amqp091.Channel, error) {
+	return concreteChannel(this.AMQPChannel())
+}
+
+func (this *Binding) AMQPChannel() (AMQPChannel, error) {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	if this.channel == nil {
@@ -57,21 +62,43 @@ func (this *Binding) Channel() (*amqp091.Channel, error) {
 		if channelError != nil {
 			return nil, channelError
 		}
+		this.connection.Register(this)
 		this.channel = channel
 	}
 	return this.channel, nil
 }
 
 func (this *Binding) Declare() error {
-	channel, channelError := this.Channel()
+	channel, channelError := this.AMQPChannel()
 	if channelError != nil {
 		return channelError
 	}
-	return channel.QueueBind(
+	bindError := channel.QueueBind(
 		this.configBinding.Queue,
 		this.configBinding.RoutingKey,
 		this.configBinding.Exchange,
 		this.configBinding.NoWait,
 		this.configBinding.Args,
 	)
+	if bindError != nil {
+		return bindError
+	}
+
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.declared = true
+	return nil
+}
+
+// Recover reopens channel and redeclares binding after reconnection
+func (this *Binding) Recover() error {
+	this.mx.Lock()
+	this.channel = nil
+	declared := this.declared
+	this.mx.Unlock()
+
+	if !declared {
+		return nil
+	}
+	return this.Declare()
 }
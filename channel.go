@@ -0,0 +1,49 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPChannel is a subset of *amqp091.Channel used by the package,
+// rabbitmqtest.Broker channels implement it for tests without rabbitmq.
+// Channel methods of Exchange, Queue, Binding, Topology, Publisher and
+// Subscriber return *amqp091.Channel, ErrorChannelType when channel
+// of another AMQPChannel implementation was set
+type AMQPChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error)
+	QueueInspect(name string) (amqp091.Queue, error)
+	QueuePurge(name string, noWait bool) (int, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp091.Table) error
+
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp091.Table) (<-chan amqp091.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp091.Confirmation) chan amqp091.Confirmation
+	NotifyReturn(returns chan amqp091.Return) chan amqp091.Return
+	GetNextPublishSeqNo() uint64
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error
+
+	IsClosed() bool
+	Close() error
+}
+
+var _ AMQPChannel = (*amqp091.Channel)(nil)
+
+func concreteChannel(channel AMQPChannel, e error) (*amqp091.Channel, error) {
+	if e != nil {
+		return nil, e
+	}
+	concrete, ok := channel.(*amqp091.Channel)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrorChannelType, channel)
+	}
+	return concrete, nil
+}
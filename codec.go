@@ -0,0 +1,252 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+const JSON_CONTENT_TYPE = "application/json"
+const BYTES_CONTENT_TYPE = "application/octet-stream"
+const TEXT_CONTENT_TYPE = "text/plain"
+const GOB_CONTENT_TYPE = "application/x-gob"
+
+const GZIP_CONTENT_ENCODING = "gzip"
+
+// Codec encodes values to message body and decodes them back
+type Codec interface {
+	ContentType() string
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte, value interface{}) error
+}
+
+// Encoding transforms encoded body, e.g. compresses it,
+// selected by ContentEncoding message property
+type Encoding interface {
+	Name() string
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+var JSONCodec Codec = jsonCodec{}
+var BytesCodec Codec = bytesCodec{}
+var TextCodec Codec = textCodec{}
+var GobCodec Codec = gobCodec{}
+
+var GzipEncoding Encoding = gzipEncoding{}
+
+var codecs = struct {
+	mx        sync.RWMutex
+	codecs    map[string]Codec
+	encodings map[string]Encoding
+}{
+	codecs: map[string]Codec{
+		JSON_CONTENT_TYPE: JSONCodec,
+		BYTES_CONTENT_TYPE: BytesCodec,
+		TEXT_CONTENT_TYPE: TextCodec,
+		GOB_CONTENT_TYPE: GobCodec,
+	},
+	encodings: map[string]Encoding{
+		GZIP_CONTENT_ENCODING: GzipEncoding,
+	},
+}
+
+// RegisterCodec adds or replaces codec for its content type
+func RegisterCodec(codec Codec) {
+	codecs.mx.Lock()
+	defer codecs.mx.Unlock()
+	codecs.codecs[mediaType(codec.ContentType())] = codec
+}
+
+// RegisterEncoding adds or replaces content encoding
+func RegisterEncoding(encoding Encoding) {
+	codecs.mx.Lock()
+	defer codecs.mx.Unlock()
+	codecs.encodings[strings.ToLower(encoding.Name())] = encoding
+}
+
+// CodecFor returns codec by content type, parameters like charset are ignored,
+// JSONCodec is used for empty content type
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec, nil
+	}
+	codecs.mx.RLock()
+	defer codecs.mx.RUnlock()
+	if codec, ok := codecs.codecs[mediaType(contentType)]; ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrorUnknownContentType, contentType)
+}
+
+// EncodingFor returns content encoding by name, nil for empty or identity
+func EncodingFor(name string) (Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "identity" {
+		return nil, nil
+	}
+	codecs.mx.RLock()
+	defer codecs.mx.RUnlock()
+	if encoding, ok := codecs.encodings[name]; ok {
+		return encoding, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrorUnknownContentEncoding, name)
+}
+
+// DecodeDelivery decodes body by delivery ContentEncoding and ContentType,
+// body of DEFAULT_MESSAGE_CONTENT_TYPE is decoded as JSON when TextCodec
+// does not support value: Publish sends JSON bodies with it by default
+func DecodeDelivery(delivery Delivery, value interface{}) error {
+	codec, codecError := CodecFor(delivery.ContentType)
+	if codecError != nil {
+		return codecError
+	}
+	e := decodeDelivery(delivery, codec, value)
+	if errors.Is(e, ErrorCodecUnsupported) && mediaType(delivery.ContentType) == DEFAULT_MESSAGE_CONTENT_TYPE {
+		return decodeDelivery(delivery, JSONCodec, value)
+	}
+	return e
+}
+
+func decodeDelivery(delivery Delivery, codec Codec, value interface{}) error {
+	encoding, encodingError := EncodingFor(delivery.ContentEncoding)
+	if encodingError != nil {
+		return encodingError
+	}
+	body := delivery.Body
+	if encoding != nil {
+		decoded, e := encoding.Decode(body)
+		if e != nil {
+			return e
+		}
+		body = decoded
+	}
+	return codec.Decode(body, value)
+}
+
+func mediaType(contentType string) string {
+	if t, _, e := mime.ParseMediaType(contentType); e == nil {
+		return t
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return JSON_CONTENT_TYPE
+}
+
+func (jsonCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Decode(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// bytesCodec passes []byte as is
+type bytesCodec struct{}
+
+func (bytesCodec) ContentType() string {
+	return BYTES_CONTENT_TYPE
+}
+
+func (bytesCodec) Encode(value interface{}) ([]byte, error) {
+	if data, ok := value.([]byte); ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: %T to %s", ErrorCodecUnsupported, value, BYTES_CONTENT_TYPE)
+}
+
+func (bytesCodec) Decode(data []byte, value interface{}) error {
+	if target, ok := value.(*[]byte); ok {
+		*target = data
+		return nil
+	}
+	return fmt.Errorf("%w: %s to %T", ErrorCodecUnsupported, BYTES_CONTENT_TYPE, value)
+}
+
+// textCodec supports strings, []byte and fmt.Stringer
+type textCodec struct{}
+
+func (textCodec) ContentType() string {
+	return TEXT_CONTENT_TYPE
+}
+
+func (textCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	default:
+		return nil, fmt.Errorf("%w: %T to %s", ErrorCodecUnsupported, value, TEXT_CONTENT_TYPE)
+	}
+}
+
+func (textCodec) Decode(data []byte, value interface{}) error {
+	switch target := value.(type) {
+	case *string:
+		*target = string(data)
+	case *[]byte:
+		*target = data
+	default:
+		return fmt.Errorf("%w: %s to %T", ErrorCodecUnsupported, TEXT_CONTENT_TYPE, value)
+	}
+	return nil
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string {
+	return GOB_CONTENT_TYPE
+}
+
+func (gobCodec) Encode(value interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if e := gob.NewEncoder(&buf).Encode(value); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte, value interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
+
+type gzipEncoding struct{}
+
+func (gzipEncoding) Name() string {
+	return GZIP_CONTENT_ENCODING
+}
+
+func (gzipEncoding) Encode(data []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+	if _, e := w.Write(data); e != nil {
+		return nil, e
+	}
+	if e := w.Close(); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipEncoding) Decode(data []byte) ([]byte, error) {
+	r, e := gzip.NewReader(bytes.NewReader(data))
+	if e != nil {
+		return nil, e
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,48 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCodecFor(t *testing.T) {
+	cases := map[string]Codec{
+		"":                                JSONCodec,
+		"application/json":                JSONCodec,
+		"application/json; charset=utf-8": JSONCodec,
+		"Text/Plain":                      TextCodec,
+		"application/octet-stream":        BytesCodec,
+		"application/x-gob":               GobCodec,
+	}
+	for contentType, expected := range cases {
+		codec, e := CodecFor(contentType)
+		if e != nil || codec != expected {
+			t.Errorf("Content type(%s) expect %T, got %T, %v", contentType, expected, codec, e)
+		}
+	}
+	if _, e := CodecFor("application/x-unknown"); !errors.Is(e, ErrorUnknownContentType) {
+		t.Errorf("Expect unknown content type, got %v", e)
+	}
+}
+
+func TestDecodeDelivery(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		body, e := codec.Encode(userChanged{ID: "42", Name: "uss"})
+		if e != nil {
+			t.Fatalf("%T unexpected encoding error: %s", codec, e)
+		}
+		if body, e = GzipEncoding.Encode(body); e != nil {
+			t.Fatalf("Unexpected gzip error: %s", e)
+		}
+
+		var decoded userChanged
+		e = DecodeDelivery(Delivery{
+			ContentType: codec.ContentType(),
+			ContentEncoding: GZIP_CONTENT_ENCODING,
+			Body: body,
+		}, &decoded)
+		if e != nil || decoded.ID != "42" || decoded.Name != "uss" {
+			t.Errorf("%T expect decoded value, got %+v, %v", codec, decoded, e)
+		}
+	}
+}
@@ -2,14 +2,65 @@ package rabbitmq
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rabbitmq/amqp091-go"
 )
 
+const AUTH_PLAIN = "plain"       // login and password
+const AUTH_EXTERNAL = "external" // SASL EXTERNAL by TLS client certificate
+
+const ENDPOINTS_ORDERED = "ordered"         // first available endpoint
+const ENDPOINTS_ROUND_ROBIN = "round-robin" // endpoint next to the previous one
+const ENDPOINTS_RANDOM = "random"           // shuffled endpoints
+
 type ConfigConnection struct {
 	Host     string `json:"host"`
 	Port     uint   `json:"port"`
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	// "/" - default vhost, leading "/" of other names is trimmed as url
+	// path separator: "/orders" is "orders" vhost, "//orders" is "/orders"
 	Vhost    string `json:"vhost"`
+
+	// cluster nodes tried in order of Strategy, Host and Port are used when empty
+	Endpoints []ConfigEndpoint `json:"endpoints"`
+	Strategy  string           `json:"strategy"`
+
+	TLS       ConfigTLS        `json:"tls"` // amqps when enabled
+	Auth      string           `json:"auth"`
+
+	Reconnect   ConfigReconnect `json:"reconnect"`
+	MaxChannels int             `json:"max-channels"` // pooled channels limit of Checkout, 0 - unlimited
+}
+
+type ConfigEndpoint struct {
+	Host string `json:"host"`
+	Port uint   `json:"port"`
+}
+
+func (e ConfigEndpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.FormatUint(uint64(e.Port), 10))
+}
+
+type ConfigTLS struct {
+	Enabled            bool   `json:"enabled"`
+	CAFile             string `json:"ca-file"`   // "" - system roots
+	CertFile           string `json:"cert-file"` // client certificate
+	KeyFile            string `json:"key-file"`
+	ServerName         string `json:"server-name"` // "" - endpoint host
+	InsecureSkipVerify bool   `json:"insecure-skip-verify"` // development only
+}
+
+type ConfigReconnect struct {
+	Enabled     bool    `json:"enabled"`
+	MinInterval string  `json:"min-interval"`
+	MaxInterval string  `json:"max-interval"`
+	Multiplier  float64 `json:"multiplier"`
+	MaxAttempts int     `json:"max-attempts"` // 0 - unlimited
 }
 
 type ConfigQueue struct {
@@ -33,6 +84,8 @@ type ConfigExchange struct {
 	NoWait     bool   `json:"no-wait"`
 
 	Args       map[string]interface{} `json:"args"`
+
+	Passive    bool   `json:"passive"`
 }
 
 type ConfigBinding struct {
@@ -44,6 +97,12 @@ type ConfigBinding struct {
 	Args       map[string]interface{} `json:"args"`
 }
 
+type ConfigTopology struct {
+	Exchanges []ConfigExchange `json:"exchanges"`
+	Queues    []ConfigQueue    `json:"queues"`
+	Bindings  []ConfigBinding  `json:"bindings"`
+}
+
 type ConfigConsumer struct {
 	Count     int    `json:"count"`
 	Queue     string `json:"queue"`
@@ -55,6 +114,8 @@ type ConfigConsumer struct {
 	NoWait    bool   `json:"no-wait"`
 
 	Args      map[string]interface{} `json:"args"`
+
+	Timeout   string `json:"timeout"` // processing deadline of single delivery
 }
 
 type ConfigQos struct {
@@ -69,22 +130,152 @@ type ConfigConflicts struct {
 	CheckIdleInterval string `json:"check-idle-interval"`
 }
 
+type ConfigBatch struct {
+	MaxSize       int    `json:"max-size"` // messages waiting for confirms at once, 0 - default
+	FlushInterval string `json:"flush-interval"`
+}
+
+type ConfigOutbox struct {
+	PollInterval     string  `json:"poll-interval"`
+	BatchSize        int     `json:"batch-size"` // pending records read at once
+	RetryDelay       string  `json:"retry-delay"`
+	RetryMaxDelay    string  `json:"retry-max-delay"`
+	RetryMultiplier  float64 `json:"retry-multiplier"`
+}
+
+type ConfigRetry struct {
+	Enabled     bool    `json:"enabled"`
+	MaxAttempts int     `json:"max-attempts"` // then message is parked
+	Delay       string  `json:"delay"`
+	MaxDelay    string  `json:"max-delay"`
+	Multiplier  float64 `json:"multiplier"`
+}
+
 type ConfigPublisher struct {
 	Exchange   string `json:"exchange"`
 	RoutingKey string `json:"routing-key"`
 	Mandatory  bool   `json:"mandatory"`
 	Immediate  bool   `json:"immediate"`
+
+	Confirm        bool   `json:"confirm"`
+	ConfirmTimeout string `json:"confirm-timeout"`
+
+	Actor          string `json:"actor"` // publisher identity for PublishMessage
+
+	// defaults of publishings, applied before PublishOption
+	DeliveryMode   uint8                  `json:"delivery-mode"` // 0 - persistent
+	ContentType    string                 `json:"content-type"`
+	AppId          string                 `json:"app-id"`
+	Headers        map[string]interface{} `json:"headers"`
+	Expiration     string                 `json:"expiration"` // message TTL duration, "" - no TTL
+}
+
+func (c ConfigConnection) Scheme() string {
+	if c.TLS.Enabled {
+		return "amqps"
+	}
+	return "amqp"
 }
 
+// Url escapes credentials and vhost, "/" vhost is encoded as "%2F",
+// TLS files, server name and EXTERNAL auth are passed by query parameters
+// https://www.rabbitmq.com/docs/uri-spec
 func (c ConfigConnection) Url() string {
-	return fmt.Sprintf(
-		"amqp://%s:%s@%s:%d%s",
-		c.Login,
-		c.Password,
-		c.Host,
-		c.Port,
-		c.Vhost,
-	)
+	return c.url().String()
+}
+
+// String is Url with redacted password for logging
+func (c ConfigConnection) String() string {
+	return c.url().Redacted()
+}
+
+func (c ConfigConnection) url() *url.URL {
+	vhost := c.Vhost
+	if vhost != "/" {
+		// compatible with vhost appended to url as is
+		vhost = strings.TrimPrefix(vhost, "/")
+	}
+	u := &url.URL{
+		Scheme: c.Scheme(),
+		User: url.UserPassword(c.Login, c.Password),
+		Host: ConfigEndpoint{Host: c.Host, Port: c.Port}.String(),
+		Path: "/" + vhost,
+		RawPath: "/" + url.PathEscape(vhost),
+	}
+
+	query := url.Values{}
+	if c.TLS.Enabled {
+		for param, value := range map[string]string{
+			"cacertfile": c.TLS.CAFile,
+			"certfile": c.TLS.CertFile,
+			"keyfile": c.TLS.KeyFile,
+			"server_name_indication": c.TLS.ServerName,
+		} {
+			if value != "" {
+				query.Set(param, value)
+			}
+		}
+	}
+	if c.Auth == AUTH_EXTERNAL {
+		query.Set("auth_mechanism", AUTH_EXTERNAL)
+	}
+	u.RawQuery = query.Encode()
+	return u
+}
+
+// ParseConfigConnection parses url built by Url into DefaultConfigConnection,
+// missed parts are defaulted as by amqp091.ParseURI
+func ParseConfigConnection(rawurl string) (ConfigConnection, error) {
+	cfg := DefaultConfigConnection
+
+	uri, uriError := amqp091.ParseURI(rawurl)
+	if uriError != nil {
+		return cfg, uriError
+	}
+	u, urlError := url.Parse(rawurl)
+	if urlError != nil {
+		return cfg, urlError
+	}
+
+	cfg.Host = uri.Host
+	cfg.Port = uint(uri.Port)
+	cfg.Login = uri.Username
+	cfg.Password = uri.Password
+	cfg.Vhost = uri.Vhost
+	if cfg.Vhost != "/" && strings.HasPrefix(cfg.Vhost, "/") {
+		// leading "/" of vhost name is doubled in config, see Vhost
+		cfg.Vhost = "/" + cfg.Vhost
+	}
+
+	cfg.TLS.Enabled = uri.Scheme == "amqps"
+	cfg.TLS.CAFile = uri.CACertFile
+	cfg.TLS.CertFile = uri.CertFile
+	cfg.TLS.KeyFile = uri.KeyFile
+	cfg.TLS.ServerName = uri.ServerName
+
+	switch mechanism := strings.ToLower(u.Query().Get("auth_mechanism")); mechanism {
+	case "":
+	case AUTH_PLAIN, AUTH_EXTERNAL:
+		cfg.Auth = mechanism
+	default:
+		return cfg, fmt.Errorf("%w: %q", ErrorUnknownAuth, mechanism)
+	}
+	return cfg, nil
+}
+
+// GetEndpoints returns Endpoints or single endpoint of Host and Port
+func (c ConfigConnection) GetEndpoints() []ConfigEndpoint {
+	if len(c.Endpoints) > 0 {
+		return c.Endpoints
+	}
+	return []ConfigEndpoint{{Host: c.Host, Port: c.Port}}
+}
+
+// WithEndpoint replaces Host and Port by endpoint ones
+func (c ConfigConnection) WithEndpoint(e ConfigEndpoint) ConfigConnection {
+	c.Host = e.Host
+	c.Port = e.Port
+	return c
 }
 
 func (cc ConfigConsumer) EnumConsumerTag(tag int) ConfigConsumer{
@@ -98,6 +289,18 @@ var DefaultConfigConnection ConfigConnection = ConfigConnection{
 	Login:    "guest",
 	Password: "guest",
 	Vhost:    "/",
+	Strategy: ENDPOINTS_ORDERED,
+	Auth:     AUTH_PLAIN,
+
+	Reconnect: DefaultConfigReconnect,
+	MaxChannels: 64,
+}
+var DefaultConfigReconnect ConfigReconnect = ConfigReconnect{
+	Enabled: true,
+	MinInterval: "1s",
+	MaxInterval: "30s",
+	Multiplier: 2,
+	MaxAttempts: 0,
 }
 var DefaultConfigQueue ConfigQueue = ConfigQueue{
 	Name:       "",
@@ -140,9 +343,31 @@ var DefaultConfigConflicts ConfigConflicts = ConfigConflicts{
 	CheckIdleTTL: "15s",
 	CheckIdleInterval: "3s",
 }
+var DefaultConfigBatch ConfigBatch = ConfigBatch{
+	MaxSize: 500,
+	FlushInterval: "100ms",
+}
+var DefaultConfigOutbox ConfigOutbox = ConfigOutbox{
+	PollInterval: "1s",
+	BatchSize: 100,
+	RetryDelay: "1s",
+	RetryMaxDelay: "1m",
+	RetryMultiplier: 2,
+}
+var DefaultConfigRetry ConfigRetry = ConfigRetry{
+	Enabled: false,
+	MaxAttempts: 5,
+	Delay: "1s",
+	MaxDelay: "5m",
+	Multiplier: 2,
+}
 var DefaultConfigPublisher ConfigPublisher = ConfigPublisher{
 	Exchange: "",
 	RoutingKey: "",
 	Mandatory: false,
 	Immediate: false,
+	Confirm: false,
+	ConfirmTimeout: "5s",
+	DeliveryMode: amqp091.Persistent,
+	ContentType: DEFAULT_MESSAGE_CONTENT_TYPE,
 }
@@ -0,0 +1,259 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const DEFAULT_CONFIRMS_BUFFER = 1024
+const DEFAULT_RETURNS_BUFFER = 1024
+
+// PUBLISH_TAG_HEADER carries delivery tag of mandatory and immediate
+// publishings to correlate broker returns with them, consumers receive
+// it with other headers of such messages
+const PUBLISH_TAG_HEADER = "x-publish-tag"
+
+// Confirmation is a handle of single publishing resolved by broker ack or nack
+type Confirmation struct {
+	DeliveryTag uint64
+
+	once        sync.Once
+	done        chan struct{}
+	err         error
+
+	returned    *amqp091.Return
+	onReturn    func(amqp091.Return)
+}
+
+func newConfirmation(tag uint64) *Confirmation {
+	return &Confirmation{
+		DeliveryTag: tag,
+		done: make(chan struct{}),
+	}
+}
+
+func resolvedConfirmation(e error) *Confirmation {
+	c := newConfirmation(0)
+	c.resolve(e)
+	return c
+}
+
+func (this *Confirmation) resolve(e error) {
+	this.once.Do(func() {
+		this.err = e
+		close(this.done)
+	})
+}
+
+func (this *Confirmation) Done() <-chan struct{} {
+	return this.done
+}
+
+// Err is nil for acknowledged publishing, valid after Done
+func (this *Confirmation) Err() error {
+	select {
+	case <-this.done:
+		return this.err
+	default:
+		return nil
+	}
+}
+
+func (this *Confirmation) Wait(ctx context.Context) error {
+	select {
+	case <-this.done:
+		return this.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// publishTracker correlates channel delivery tags with publishings
+// and listens for returned unroutable messages. Channel is always put
+// into confirm mode: acks release pending publishings, including ones
+// of callers not waiting for confirms. Tracker lives as long as channel:
+// listener stops when channel is closed
+type publishTracker struct {
+	publishMx sync.Mutex // serializes publishings of shared channel
+	mx        sync.Mutex // guards pending, never held while calling channel
+
+	channel   AMQPChannel
+	pending   map[uint64]*Confirmation
+}
+
+// trackers keeps single tracker per channel: publishers sharing channel,
+// pooled or set by SetChannel, read sequence numbers and send under
+// the same lock. Tracker is forgotten when its channel is closed
+var trackers = struct {
+	mx       sync.Mutex
+	channels map[AMQPChannel]*publishTracker
+}{
+	channels: map[AMQPChannel]*publishTracker{},
+}
+
+func trackerOf(channel AMQPChannel) (*publishTracker, error) {
+	trackers.mx.Lock()
+	defer trackers.mx.Unlock()
+	if tracker, ok := trackers.channels[channel]; ok {
+		return tracker, nil
+	}
+	tracker, trackerError := newPublishTracker(channel)
+	if trackerError != nil {
+		return nil, trackerError
+	}
+	trackers.channels[channel] = tracker
+	return tracker, nil
+}
+
+func newPublishTracker(channel AMQPChannel) (*publishTracker, error) {
+	tracker := &publishTracker{
+		channel: channel,
+		pending: make(map[uint64]*Confirmation),
+	}
+
+	if e := channel.Confirm(false); e != nil {
+		return nil, e
+	}
+	confirms := channel.NotifyPublish(make(chan amqp091.Confirmation, DEFAULT_CONFIRMS_BUFFER))
+	returns := channel.NotifyReturn(make(chan amqp091.Return, DEFAULT_RETURNS_BUFFER))
+
+	go tracker.listen(confirms, returns)
+	return tracker, nil
+}
+
+// publish registers confirmation before send, so ack received right
+// after send is not missed. Listener lock is not held while channel is
+// called: amqp091 blocks on full confirms buffer until listener reads it.
+// Mandatory and immediate publishings are stamped by PUBLISH_TAG_HEADER
+// to correlate returns with them, onReturn receives own returns only.
+// Without confirm already resolved confirmation is returned
+func (this *publishTracker) publish(channel AMQPChannel, publish Publish, confirm bool, onReturn func(amqp091.Return), send func(Publish) error) (*Confirmation, error) {
+	this.publishMx.Lock()
+	defer this.publishMx.Unlock()
+
+	confirmation := newConfirmation(channel.GetNextPublishSeqNo())
+	confirmation.onReturn = onReturn
+	if publish.Mandatory || publish.Immediate {
+		// copy: caller headers must not be modified
+		headers := amqp091.Table{}
+		for name, value := range publish.Message.Headers {
+			headers[name] = value
+		}
+		headers[PUBLISH_TAG_HEADER] = int64(confirmation.DeliveryTag)
+		publish.Message.Headers = headers
+	}
+
+	this.mx.Lock()
+	this.pending[confirmation.DeliveryTag] = confirmation
+	this.mx.Unlock()
+
+	if e := send(publish); e != nil {
+		this.mx.Lock()
+		delete(this.pending, confirmation.DeliveryTag)
+		this.mx.Unlock()
+		return nil, e
+	}
+	if !confirm {
+		return resolvedConfirmation(nil), nil
+	}
+	return confirmation, nil
+}
+
+func (this *publishTracker) listen(confirms <-chan amqp091.Confirmation, returns <-chan amqp091.Return) {
+	for confirms != nil {
+		select {
+		case returned, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			this.returned(returned)
+		case confirmed, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			// broker sends basic.return before basic.ack of the same
+			// publishing, so it is already buffered
+			returns = this.drainReturns(returns)
+			this.confirmed(confirmed)
+		}
+	}
+
+	// channel closed, nothing will be confirmed anymore
+	trackers.mx.Lock()
+	if trackers.channels[this.channel] == this {
+		delete(trackers.channels, this.channel)
+	}
+	trackers.mx.Unlock()
+
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	for tag, confirmation := range this.pending {
+		confirmation.resolve(ErrorChannelClosed)
+		delete(this.pending, tag)
+	}
+}
+
+func (this *publishTracker) drainReturns(returns <-chan amqp091.Return) <-chan amqp091.Return {
+	for returns != nil {
+		select {
+		case returned, ok := <-returns:
+			if !ok {
+				return nil
+			}
+			this.returned(returned)
+		default:
+			return returns
+		}
+	}
+	return nil
+}
+
+func (this *publishTracker) confirmed(confirmed amqp091.Confirmation) {
+	this.mx.Lock()
+	confirmation, ok := this.pending[confirmed.DeliveryTag]
+	delete(this.pending, confirmed.DeliveryTag)
+	this.mx.Unlock()
+
+	if !ok {
+		return
+	}
+	switch {
+	case !confirmed.Ack:
+		confirmation.resolve(ErrorMessageNacked)
+	case confirmation.returned != nil:
+		confirmation.resolve(fmt.Errorf(
+			"%w: %d %s",
+			ErrorUnroutable,
+			confirmation.returned.ReplyCode,
+			confirmation.returned.ReplyText,
+		))
+	default:
+		confirmation.resolve(nil)
+	}
+}
+
+// returned marks pending publishing by PUBLISH_TAG_HEADER, returns of
+// other trackers of the same channel are ignored
+func (this *publishTracker) returned(returned amqp091.Return) {
+	tag, ok := returned.Headers[PUBLISH_TAG_HEADER].(int64)
+	if !ok {
+		return
+	}
+
+	this.mx.Lock()
+	confirmation, found := this.pending[uint64(tag)]
+	if found {
+		confirmation.returned = &returned
+	}
+	this.mx.Unlock()
+
+	if found && confirmation.onReturn != nil {
+		// callback must not block dispatching of acks
+		go confirmation.onReturn(returned)
+	}
+}
@@ -0,0 +1,87 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// confirmsChannel records notification channels like amqp091 does
+type confirmsChannel struct {
+	AMQPChannel
+
+	seq      uint64
+	confirms chan amqp091.Confirmation
+	returns  chan amqp091.Return
+}
+
+func (this *confirmsChannel) Confirm(noWait bool) error {
+	return nil
+}
+
+func (this *confirmsChannel) NotifyPublish(confirms chan amqp091.Confirmation) chan amqp091.Confirmation {
+	this.confirms = confirms
+	return confirms
+}
+
+func (this *confirmsChannel) NotifyReturn(returns chan amqp091.Return) chan amqp091.Return {
+	this.returns = returns
+	return returns
+}
+
+func (this *confirmsChannel) GetNextPublishSeqNo() uint64 {
+	this.seq++
+	return this.seq
+}
+
+func TestPublishTrackerMultipleAck(t *testing.T) {
+	channel := &confirmsChannel{}
+	tracker, e := newPublishTracker(channel)
+	if e != nil {
+		t.Fatalf("Unexpected tracker error: %s", e)
+	}
+
+	const total = DEFAULT_CONFIRMS_BUFFER + 100
+	confirmations := make([]*Confirmation, 0, total)
+	for i := 0; i < total-1; i++ {
+		c, e := tracker.publish(channel, Publish{}, true, nil, func(Publish) error { return nil })
+		if e != nil {
+			t.Fatalf("Unexpected publish error: %s", e)
+		}
+		confirmations = append(confirmations, c)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// amqp091 reader splits multiple ack into blocking sends of every tag
+		// while the last publishing is in flight
+		c, e := tracker.publish(channel, Publish{}, true, nil, func(Publish) error {
+			for tag := uint64(1); tag <= total; tag++ {
+				channel.confirms <- amqp091.Confirmation{DeliveryTag: tag, Ack: true}
+			}
+			return nil
+		})
+		if e != nil {
+			t.Errorf("Unexpected publish error: %s", e)
+			return
+		}
+		confirmations = append(confirmations, c)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Publishing deadlocked on multiple ack of %d tags", total)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, c := range confirmations {
+		if e := c.Wait(ctx); e != nil {
+			t.Fatalf("Expect ack of %d, got %s", c.DeliveryTag, e)
+		}
+	}
+}
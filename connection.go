@@ -1,7 +1,12 @@
 package rabbitmq
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -12,28 +17,259 @@ func NewConnection(cfg ConfigConnection) *Connection {
 	}
 }
 
+// Recoverable is implemented by channel owners (Exchange, Queue, Binding,
+// Publisher, Subscriber) to reopen channels and redeclare after reconnection
+type Recoverable interface {
+	Recover() error
+}
+
+type reconnectCallback func(attempt int, e error)
+
 type Connection struct {
-	cfg        ConfigConnection
+	cfg          ConfigConnection
+
+	mx           sync.Mutex
+	connection   *amqp091.Connection
+	channels     []*amqp091.Channel
 
-	mx         sync.Mutex
-	connection *amqp091.Connection
-	channels   []*amqp091.Channel
+	// pool of Checkout, limited by MaxChannels
+	pooled       []AMQPChannel
+	idle         []AMQPChannel // pooled channels available for Checkout
+	opening      int           // pooled channels being opened
+	available    chan struct{} // closed when channel is released or closed
+	openChannel  func() (AMQPChannel, error)
+
+	recoverables []Recoverable
+	disconnected bool
+	endpoint     *ConfigEndpoint // connected node
+	next         int             // round robin position
+
+	reconnectCallback reconnectCallback
 }
 
-func (this *Connection) Connect() error {
+// ReconnectCallback receives every failed reconnection or recovery attempt
+// and nil error once connection was reestablished
+func (this *Connection) ReconnectCallback(fn reconnectCallback) *Connection {
 	this.mx.Lock()
 	defer this.mx.Unlock()
-	if this.connection != nil {
+	this.reconnectCallback = fn
+	return this
+}
+
+func (this *Connection) Connect() error {
+	this.mx.Lock()
+	this.disconnected = false
+	this.mx.Unlock()
+	return this.connect()
+}
+
+// connect dials without lock, so Connection stays usable while endpoints
+// are tried, dialed connection is closed when another one was installed
+// or Disconnect was called meanwhile
+func (this *Connection) connect() error {
+	this.mx.Lock()
+	connected := this.connection != nil
+	order, orderError := this.endpointsOrder()
+	this.mx.Unlock()
+	if connected {
 		return ErrorAlreadyConnected
 	}
-	connection, connectionError := amqp091.Dial(this.cfg.Url())
-	if connectionError != nil {
-		return connectionError
+	if orderError != nil {
+		return orderError
 	}
+
+	connection, i, dialError := this.dial(order)
+	if dialError != nil {
+		return dialError
+	}
+
+	closing := connection.NotifyClose(make(chan *amqp091.Error, 1))
+	this.mx.Lock()
+	if this.connection != nil || this.disconnected {
+		e := ErrorAlreadyConnected
+		if this.disconnected {
+			e = ErrorConnectionClosed
+		}
+		this.mx.Unlock()
+		connection.Close()
+		return e
+	}
+	endpoint := this.cfg.GetEndpoints()[i]
 	this.connection = connection
+	this.endpoint = &endpoint
+	this.next = i + 1
+	this.mx.Unlock()
+	go this.watch(connection, closing)
 	return nil
 }
 
+// dial tries endpoints one by one in order of configured strategy,
+// returns connection with position of connected endpoint
+func (this *Connection) dial(order []int) (*amqp091.Connection, int, error) {
+	endpoints := this.cfg.GetEndpoints()
+	errs := make([]error, 0, len(order))
+	for _, i := range order {
+		endpoint := endpoints[i]
+		cfg := this.cfg.WithEndpoint(endpoint)
+		// per endpoint: TLS server name defaults to endpoint host
+		config, configError := cfg.AMQPConfig()
+		if configError != nil {
+			return nil, 0, configError
+		}
+		connection, e := amqp091.DialConfig(cfg.Url(), config)
+		if e != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, e))
+			continue
+		}
+		return connection, i, nil
+	}
+	return nil, 0, errors.Join(errs...)
+}
+
+func (this *Connection) endpointsOrder() ([]int, error) {
+	count := len(this.cfg.GetEndpoints())
+	order := make([]int, count)
+	for i := range order {
+		order[i] = i
+	}
+
+	switch this.cfg.Strategy {
+	case "", ENDPOINTS_ORDERED:
+	case ENDPOINTS_ROUND_ROBIN:
+		for i := range order {
+			order[i] = (this.next + i) % count
+		}
+	case ENDPOINTS_RANDOM:
+		rand.Shuffle(count, func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrorUnknownStrategy, this.cfg.Strategy)
+	}
+	return order, nil
+}
+
+// Endpoint returns currently connected node, false when disconnected
+func (this *Connection) Endpoint() (ConfigEndpoint, bool) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.connection == nil || this.endpoint == nil {
+		return ConfigEndpoint{}, false
+	}
+	return *this.endpoint, true
+}
+
+func (this *Connection) watch(connection *amqp091.Connection, closing <-chan *amqp091.Error) {
+	closeError := <-closing // nil on graceful close
+
+	this.mx.Lock()
+	if this.connection != connection {
+		// disconnected or already replaced
+		this.mx.Unlock()
+		return
+	}
+	this.connection = nil
+	this.channels = nil
+	this.dropPool()
+	reconnect := closeError != nil && this.cfg.Reconnect.Enabled && !this.disconnected
+	this.mx.Unlock()
+
+	if reconnect {
+		this.reconnect()
+	}
+}
+
+// reconnect dials with backoff, then recovers registered channel owners,
+// failed ones are retried with the same backoff while connection is alive
+func (this *Connection) reconnect() {
+	cfg := this.cfg.Reconnect
+	b, backoffError := newBackoff(cfg.MinInterval, cfg.MaxInterval, cfg.Multiplier)
+	if backoffError != nil {
+		this.notifyReconnect(0, backoffError)
+		return
+	}
+
+	var connection *amqp091.Connection
+	var recoverables []Recoverable
+	for attempt := 1; ; attempt++ {
+		if cfg.MaxAttempts > 0 && attempt > cfg.MaxAttempts {
+			this.notifyReconnect(attempt, ErrorReconnectAttempts)
+			return
+		}
+
+		time.Sleep(b.delay(attempt))
+
+		this.mx.Lock()
+		lost := this.disconnected || (connection != nil && this.connection != connection)
+		this.mx.Unlock()
+		if lost {
+			// lost again connection is reconnected by its own watcher
+			return
+		}
+		if connection == nil {
+			if e := this.connect(); e != nil && e != ErrorAlreadyConnected {
+				this.notifyReconnect(attempt, e)
+				continue
+			}
+			this.mx.Lock()
+			connection = this.connection
+			recoverables = make([]Recoverable, len(this.recoverables))
+			copy(recoverables, this.recoverables)
+			this.mx.Unlock()
+			if connection == nil {
+				// lost right after connection, its watcher reconnects
+				return
+			}
+
+			this.notifyReconnect(attempt, nil)
+			// recovery attempts are counted from connection
+			attempt = 0
+		}
+
+		if recoverables = this.recover(attempt, recoverables); len(recoverables) == 0 {
+			return
+		}
+	}
+}
+
+// recover in registration order: usually exchanges and queues
+// are declared before bindings, publishers and subscribers,
+// returns failed recoverables
+func (this *Connection) recover(attempt int, recoverables []Recoverable) []Recoverable {
+	failed := []Recoverable{}
+	for _, r := range recoverables {
+		if e := r.Recover(); e != nil {
+			this.notifyReconnect(attempt, e)
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+func (this *Connection) notifyReconnect(attempt int, e error) {
+	this.mx.Lock()
+	cb := this.reconnectCallback
+	this.mx.Unlock()
+	if cb != nil {
+		cb(attempt, e)
+	}
+}
+
+// Register channel owner to be recovered after reconnection
+func (this *Connection) Register(r Recoverable) {
+	if this == nil {
+		return
+	}
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	for _, registered := range this.recoverables {
+		if registered == r {
+			return
+		}
+	}
+	this.recoverables = append(this.recoverables, r)
+}
+
 func (this *Connection) GetChannel() (*amqp091.Channel, error) {
 	if this == nil {
 		return nil, ErrorMissedConnection
@@ -43,31 +279,153 @@ func (this *Connection) GetChannel() (*amqp091.Channel, error) {
 			return nil, e
 		}
 	}
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.connection == nil {
+		return nil, ErrorConnectionClosed
+	}
 	channel, channelError := this.connection.Channel()
 	if channelError != nil {
 		return nil, channelError
 	}
-	this.mx.Lock()
-	defer this.mx.Unlock()
 	this.channels = append(this.channels, channel)
 	return channel, nil
 }
 
-func (this *Connection) CloseChannel(toclose *amqp091.Channel) error {
+func (this *Connection) CloseChannel(toclose AMQPChannel) error {
 	this.mx.Lock()
 	defer this.mx.Unlock()
+	if this.removeChannel(toclose) {
+		defer toclose.Close()
+	}
+	return nil
+}
+
+func (this *Connection) removeChannel(toremove AMQPChannel) bool {
+	removed := this.removePooled(toremove)
 	for pos, channel := range this.channels {
-		if toclose == channel {
+		if toremove == channel {
 			newchannels := make([]*amqp091.Channel, len(this.channels)-1)
 			copy(newchannels[:pos], this.channels[:pos])
 			copy(newchannels[pos:], this.channels[pos+1:])
 
 			this.channels = newchannels
-			defer toclose.Close()
+			return true
+		}
+	}
+	return removed
+}
+
+func (this *Connection) removePooled(toremove AMQPChannel) bool {
+	for pos, channel := range this.idle {
+		if toremove == channel {
+			this.idle = append(this.idle[:pos:pos], this.idle[pos+1:]...)
 			break
 		}
 	}
-	return nil
+	for pos, channel := range this.pooled {
+		if toremove == channel {
+			this.pooled = append(this.pooled[:pos:pos], this.pooled[pos+1:]...)
+			this.notifyAvailable()
+			return true
+		}
+	}
+	return false
+}
+
+// dropPool forgets channels of closed connection,
+// their trackers stop with closed channels
+func (this *Connection) dropPool() {
+	this.pooled = nil
+	this.idle = nil
+	this.notifyAvailable()
+}
+
+// Checkout takes idle channel of the pool or opens new one,
+// waits for Release when MaxChannels pooled channels are open.
+// Channel is used by single goroutine until it is returned by Release.
+// Channels of GetChannel are not limited by MaxChannels
+func (this *Connection) Checkout(ctx context.Context) (AMQPChannel, error) {
+	for {
+		this.mx.Lock()
+		for len(this.idle) > 0 {
+			channel := this.idle[len(this.idle)-1]
+			this.idle = this.idle[:len(this.idle)-1]
+			if !channel.IsClosed() {
+				this.mx.Unlock()
+				return channel, nil
+			}
+			this.removeChannel(channel)
+		}
+		limit := this.cfg.MaxChannels
+		if limit <= 0 || len(this.pooled)+this.opening < limit {
+			this.opening++
+			open := this.openChannel
+			this.mx.Unlock()
+
+			if open == nil {
+				open = this.openPooled
+			}
+			channel, channelError := open()
+
+			this.mx.Lock()
+			this.opening--
+			if channelError != nil {
+				this.notifyAvailable()
+			} else {
+				this.pooled = append(this.pooled, channel)
+			}
+			this.mx.Unlock()
+			return channel, channelError
+		}
+		if this.available == nil {
+			this.available = make(chan struct{})
+		}
+		available := this.available
+		this.mx.Unlock()
+
+		select {
+		case <-available:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (this *Connection) openPooled() (AMQPChannel, error) {
+	channel, channelError := this.GetChannel()
+	if channelError != nil {
+		return nil, channelError
+	}
+	return channel, nil
+}
+
+// Release returns checked out channel to the pool,
+// closed channel is dropped and frees place for a new one
+func (this *Connection) Release(channel AMQPChannel) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if channel.IsClosed() {
+		this.removeChannel(channel)
+		return
+	}
+	for _, pooled := range this.pooled {
+		if channel == pooled {
+			this.idle = append(this.idle, pooled)
+			this.notifyAvailable()
+			return
+		}
+	}
+	// channel of previous connection
+	channel.Close()
+}
+
+// notifyAvailable wakes up Checkout waiters
+func (this *Connection) notifyAvailable() {
+	if this.available != nil {
+		close(this.available)
+		this.available = nil
+	}
 }
 
 func (this *Connection) Disconnect() error {
@@ -81,7 +439,13 @@ func (this *Connection) Disconnect() error {
 		toclose := channel
 		defer toclose.Close()
 	}
+	for _, channel := range this.pooled {
+		toclose := channel
+		defer toclose.Close()
+	}
 	this.connection = nil
 	this.channels = nil
+	this.dropPool()
+	this.disconnected = true
 	return nil
 }
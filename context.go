@@ -0,0 +1,68 @@
+package rabbitmq
+
+import (
+	"context"
+)
+
+// ContextParser is context-aware ProcessableParser, ctx is cancelled
+// on Subscriber.Stop and limited by ConfigConsumer.Timeout
+type ContextParser interface {
+	Match(key string) bool
+	ParseContext(ctx context.Context, key string, msg []byte) (ContextEntity, error)
+}
+
+// ContextEntity is context-aware ProcessableEntity
+type ContextEntity interface {
+	ProcessContext(ctx context.Context) error
+	EntityID() string // conflict tracking
+	MarkConflict() error
+}
+
+// ParserWithContext adapts ProcessableParser to ContextParser
+func ParserWithContext(parser ProcessableParser) ContextParser {
+	return contextParser{parser}
+}
+
+// EntityWithContext adapts ProcessableEntity to ContextEntity
+func EntityWithContext(entity ProcessableEntity) ContextEntity {
+	if e, ok := entity.(ContextEntity); ok {
+		return e
+	}
+	return contextEntity{entity}
+}
+
+type contextParser struct {
+	ProcessableParser
+}
+
+func (this contextParser) ParseContext(ctx context.Context, key string, msg []byte) (ContextEntity, error) {
+	entity, e := this.Parse(key, msg)
+	if e != nil {
+		return nil, e
+	}
+	return EntityWithContext(entity), nil
+}
+
+func (this contextParser) unwrap() interface{} {
+	return this.ProcessableParser
+}
+
+type contextEntity struct {
+	ProcessableEntity
+}
+
+func (this contextEntity) ProcessContext(ctx context.Context) error {
+	return this.Process()
+}
+
+type deliveryContextKey struct{}
+
+func withDelivery(ctx context.Context, delivery Delivery) context.Context {
+	return context.WithValue(ctx, deliveryContextKey{}, delivery)
+}
+
+// DeliveryFromContext returns delivery being processed
+func DeliveryFromContext(ctx context.Context) (Delivery, bool) {
+	delivery, ok := ctx.Value(deliveryContextKey{}).(Delivery)
+	return delivery, ok
+}
@@ -0,0 +1,86 @@
+package rabbitmq
+
+import (
+	"context"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Delivery is a read-only view of received message metadata and body
+type Delivery struct {
+	Exchange        string
+	RoutingKey      string
+	ConsumerTag     string
+	DeliveryTag     uint64
+	Redelivered     bool
+
+	Headers         amqp091.Table
+	ContentType     string
+	ContentEncoding string
+	DeliveryMode    uint8
+	Priority        uint8
+	CorrelationId   string
+	ReplyTo         string
+	Expiration      string
+	MessageId       string
+	Timestamp       time.Time
+	Type            string
+	UserId          string
+	AppId           string
+
+	Body            []byte
+}
+
+func NewDelivery(msg amqp091.Delivery) Delivery {
+	return Delivery{
+		Exchange: msg.Exchange,
+		RoutingKey: msg.RoutingKey,
+		ConsumerTag: msg.ConsumerTag,
+		DeliveryTag: msg.DeliveryTag,
+		Redelivered: msg.Redelivered,
+		Headers: msg.Headers,
+		ContentType: msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode: msg.DeliveryMode,
+		Priority: msg.Priority,
+		CorrelationId: msg.CorrelationId,
+		ReplyTo: msg.ReplyTo,
+		Expiration: msg.Expiration,
+		MessageId: msg.MessageId,
+		Timestamp: msg.Timestamp,
+		Type: msg.Type,
+		UserId: msg.UserId,
+		AppId: msg.AppId,
+		Body: msg.Body,
+	}
+}
+
+// Header returns header value, nil when header is missed
+func (this Delivery) Header(name string) interface{} {
+	return this.Headers[name]
+}
+
+// DeliveryParser receives full delivery metadata: headers, ids,
+// redelivered flag, etc.
+type DeliveryParser interface {
+	Match(key string) bool
+	ParseDelivery(ctx context.Context, delivery Delivery) (ContextEntity, error)
+}
+
+// ParserWithDelivery adapts ContextParser to DeliveryParser
+func ParserWithDelivery(parser ContextParser) DeliveryParser {
+	return deliveryParser{parser}
+}
+
+type deliveryParser struct {
+	ContextParser
+}
+
+func (this deliveryParser) ParseDelivery(ctx context.Context, delivery Delivery) (ContextEntity, error) {
+	return this.ParseContext(ctx, delivery.RoutingKey, delivery.Body)
+}
+
+func (this deliveryParser) unwrap() interface{} {
+	return this.ContextParser
+}
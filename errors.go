@@ -12,18 +12,46 @@ var ErrorMissedExchangeConfig    error = errors.New("Missed rabbitmq exchange co
 var ErrorMissedQueueConfig       error = errors.New("Missed rabbitmq queue config")
 var ErrorMissedBindingConfig     error = errors.New("Missed rabbitmq binding config")
 
+var ErrorPassiveDeclaration      error = errors.New("Required rabbitmq entity does not exist or differs")
+var ErrorInvalidTopology         error = errors.New("Invalid rabbitmq topology")
+
 var ErrorMissedParsers           error = errors.New("Missed parsers for queue processing")
 var ErrorMissedConnection        error = errors.New("Missed rabbitmq connection")
 var ErrorConnectionClosed        error = errors.New("Closed rabbitmq connection")
 var ErrorConnectionRequired      error = errors.New("Create channel require connection")
 var ErrorAlreadyConnected        error = errors.New("Connection for rabbitmq already established")
+var ErrorUnknownAuth             error = errors.New("Unknown rabbitmq authentication mechanism")
+var ErrorInvalidCA               error = errors.New("No certificates in rabbitmq CA file")
+var ErrorUnknownStrategy         error = errors.New("Unknown rabbitmq endpoints strategy")
+var ErrorRetryConnectionRequired error = errors.New("Retry requires rabbitmq connection or channel")
+var ErrorReconnectAttempts       error = errors.New("Reconnection attempts to rabbitmq exhausted")
 
 var ErrorUnprocessable           error = errors.New("Unprocessable entity")
 var ErrorProcessingDuration      error = errors.New("Long entity processing")
+var ErrorParsingFailed           error = errors.New("Entity parsing failed")
+var ErrorProcessingFailed        error = errors.New("Entity processing failed")
+
+var ErrorRouteDuplicate          error = errors.New("Duplicated routing pattern")
+var ErrorRouteShadowed           error = errors.New("Routing pattern is shadowed")
+
+var ErrorUnknownContentType      error = errors.New("Unknown message content type")
+var ErrorUnknownContentEncoding  error = errors.New("Unknown message content encoding")
+var ErrorCodecUnsupported        error = errors.New("Codec does not support value")
 
 var ErrorUnavailablePublisher    error = errors.New("Such publisher does not exist")
 
 var ErrorMissedPublisherExchange error = errors.New("Publisher doesn't have exchange to push")
+var ErrorMessageNacked           error = errors.New("Message rejected by rabbitmq")
+var ErrorConfirmTimeout          error = errors.New("Message confirmation timed out")
+var ErrorUnroutable              error = errors.New("Message returned as unroutable")
+var ErrorConfirmRequired         error = errors.New("Publisher confirm mode required")
+var ErrorBatcherClosed           error = errors.New("Batcher is closed")
+var ErrorOutboxConfirmRequired   error = errors.New("Outbox relay requires publisher in confirm mode")
+var ErrorOutboxRecordNotFound    error = errors.New("Outbox record not found")
+var ErrorInvalidInterval         error = errors.New("Interval must be positive")
+var ErrorChannelType             error = errors.New("Rabbitmq channel is not *amqp091.Channel")
+var ErrorChannelClosed           error = errors.New("Closed rabbitmq channel")
+var ErrorChannelPooled           error = errors.New("Publisher uses pooled rabbitmq channels, set Dedicated to use own one")
 
 var ErrorLockForKeyNotFoundError error = errors.New("lock for key not found")
 var ErrorLockForIdNotFoundError  error = errors.New("lock for id not found")
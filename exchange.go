@@ -1,6 +1,7 @@
 package rabbitmq
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/rabbitmq/amqp091-go"
@@ -20,7 +21,8 @@ type Exchange struct {
 	configExchange   ConfigExchange
 
 	connection       *Connection
-	channel          *amqp091.Channel
+	channel          AMQPChannel
+	declared         bool
 }
 
 func (this *Exchange) ConfigConnection(cfg ConfigConnection) *Exchange {
@@ -38,7 +40,7 @@ func (this *Exchange) SetConnection(connection *Connection) *Exchange {
 	return this
 }
 
-func (this *Exchange) SetChannel(channel *amqp091.Channel) *Exchange {
+func (this *Exchange) SetChannel(channel AMQPChannel) *Exchange {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	this.channel = channel
@@ -46,6 +48,10 @@ func (this *Exchange) SetChannel(channel *amqp091.Channel) *Exchange {
 }
 
 func (this *Exchange) Channel() (*amqp091.Channel, error) {
+	return concreteChannel(this.AMQPChannel())
+}
+
+func (this *Exchange) AMQPChannel() (AMQPChannel, error) {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	if this.channel == nil {
@@ -56,13 +62,14 @@ func (this *Exchange) Channel() (*amqp091.Channel, error) {
 		if channelError != nil {
 			return nil, channelError
 		}
+		this.connection.Register(this)
 		this.channel = channel
 	}
 	return this.channel, nil
 }
 
 func (this *Exchange) Declare() error {
-	channel, channelError := this.Channel()
+	channel, channelError := this.AMQPChannel()
 	if channelError != nil {
 		return channelError
 	}
@@ -71,7 +78,12 @@ func (this *Exchange) Declare() error {
 		return e
 	}
 
-	return channel.ExchangeDeclare(
+	declare := channel.ExchangeDeclare
+	if this.configExchange.Passive {
+		declare = channel.ExchangeDeclarePassive
+	}
+
+	declareError := declare(
 		this.configExchange.Name,
 		this.configExchange.Type,
 		this.configExchange.Durable,
@@ -80,6 +92,30 @@ func (this *Exchange) Declare() error {
 		this.configExchange.NoWait,
 		this.configExchange.Args,
 	)
+	if declareError != nil && this.configExchange.Passive {
+		return fmt.Errorf("%w: exchange %q: %w", ErrorPassiveDeclaration, this.configExchange.Name, declareError)
+	}
+	if declareError != nil {
+		return declareError
+	}
+
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.declared = true
+	return nil
+}
+
+// Recover reopens channel and redeclares exchange after reconnection
+func (this *Exchange) Recover() error {
+	this.mx.Lock()
+	this.channel = nil
+	declared := this.declared
+	this.mx.Unlock()
+
+	if !declared {
+		return nil
+	}
+	return this.Declare()
 }
 
 func (this *Exchange) GetName() string {
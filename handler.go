@@ -0,0 +1,72 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+)
+
+// Handler processes message body decoded into T
+type Handler[T any] func(ctx context.Context, value T, delivery Delivery) error
+
+// Handle registers typed handler for routing key pattern in the Subscriber
+// router, body is decoded by codec registered for delivery ContentType,
+// JSONCodec is used when content type is empty or default text/plain
+// does not fit T
+func Handle[T any](s *Subscriber, pattern string, fn Handler[T]) *Subscriber {
+	return HandleWithCodec(s, nil, pattern, fn)
+}
+
+func HandleWithCodec[T any](s *Subscriber, codec Codec, pattern string, fn Handler[T]) *Subscriber {
+	s.Router().route(pattern, func(ctx context.Context, delivery Delivery) (ContextEntity, error) {
+		entity := &handlerEntity[T]{
+			handler: fn,
+			delivery: delivery,
+		}
+		decode := func() error {
+			if codec == nil {
+				return DecodeDelivery(delivery, &entity.value)
+			}
+			return decodeDelivery(delivery, codec, &entity.value)
+		}
+		if e := decode(); e != nil {
+			return nil, e
+		}
+		return entity, nil
+	})
+	return s
+}
+
+// handlerEntity uses EntityID and MarkConflict of T when implemented,
+// otherwise message id or delivery tag is used for conflict tracking
+type handlerEntity[T any] struct {
+	handler  Handler[T]
+	value    T
+	delivery Delivery
+}
+
+func (this *handlerEntity[T]) ProcessContext(ctx context.Context) error {
+	return this.handler(ctx, this.value, this.delivery)
+}
+
+func (this *handlerEntity[T]) EntityID() string {
+	if v, ok := interface{}(this.value).(interface{ EntityID() string }); ok {
+		return v.EntityID()
+	}
+	if v, ok := interface{}(&this.value).(interface{ EntityID() string }); ok {
+		return v.EntityID()
+	}
+	if this.delivery.MessageId != "" {
+		return this.delivery.MessageId
+	}
+	return fmt.Sprintf("%s#%d", this.delivery.RoutingKey, this.delivery.DeliveryTag)
+}
+
+func (this *handlerEntity[T]) MarkConflict() error {
+	if v, ok := interface{}(this.value).(interface{ MarkConflict() error }); ok {
+		return v.MarkConflict()
+	}
+	if v, ok := interface{}(&this.value).(interface{ MarkConflict() error }); ok {
+		return v.MarkConflict()
+	}
+	return nil
+}
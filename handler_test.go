@@ -0,0 +1,69 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fvaleriy89/rabbitmq/rabbitmqtest"
+)
+
+type userChanged struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (this userChanged) EntityID() string { return this.ID }
+
+func TestHandle(t *testing.T) {
+	var handled userChanged
+	s := Handle(NewSubscriber(), "change.user.*", func(ctx context.Context, u userChanged, d Delivery) error {
+		handled = u
+		return nil
+	})
+
+	entity, e := s.Router().ParseDelivery(context.Background(), Delivery{
+		RoutingKey: "change.user.uss",
+		Body: []byte(`{"id": "42", "name": "uss"}`),
+	})
+	if e != nil {
+		t.Fatalf("Unexpected parsing error: %s", e)
+	}
+	if id := entity.EntityID(); id != "42" {
+		t.Errorf("Expect entity id from value, got %s", id)
+	}
+	if e := entity.ProcessContext(context.Background()); e != nil || handled.Name != "uss" {
+		t.Errorf("Expect handled value, got %+v, %v", handled, e)
+	}
+}
+
+func TestHandlePublished(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	handled := make(chan userChanged, 1)
+	s := Handle(NewSubscriber(), "user.*", func(ctx context.Context, u userChanged, d Delivery) error {
+		handled <- u
+		return nil
+	})
+	s.SetChannel(broker.Channel()).ConfigConsumer(ConfigConsumer{Count: 1, Queue: "users", Consumer: "users"})
+	if e := s.ListenDelivery(); e != nil {
+		t.Fatalf("Unexpected listen error: %s", e)
+	}
+	defer s.Stop(context.Background())
+
+	// JSON body with default text/plain content type
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	if e := publisher.Publish([]byte(`{"id": "42", "name": "uss"}`), PubRoutingKey("user.changed")); e != nil {
+		t.Fatalf("Unexpected publish error: %s", e)
+	}
+
+	select {
+	case u := <-handled:
+		if u.ID != "42" || u.Name != "uss" {
+			t.Errorf("Expect decoded user, got %+v", u)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Message was not handled")
+	}
+}
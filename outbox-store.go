@@ -0,0 +1,193 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{}
+}
+
+// MemoryOutboxStore keeps records in memory, delivered records are removed
+type MemoryOutboxStore struct {
+	mx       sync.Mutex
+	records  []OutboxRecord
+	sequence int64
+}
+
+func (this *MemoryOutboxStore) Add(ctx context.Context, records ...OutboxRecord) error {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.add(records)
+	return nil
+}
+
+func (this *MemoryOutboxStore) add(records []OutboxRecord) {
+	now := time.Now()
+	for _, record := range records {
+		this.sequence++
+		if record.Id == "" {
+			record.Id = strconv.FormatInt(this.sequence, 10)
+		}
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = now
+		}
+		this.records = append(this.records, record)
+	}
+}
+
+func (this *MemoryOutboxStore) Pending(ctx context.Context, now time.Time, limit int) ([]OutboxRecord, error) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	pending := []OutboxRecord{}
+	blocked := map[string]bool{}
+	for _, record := range this.records {
+		if limit > 0 && len(pending) == limit {
+			break
+		}
+		key := record.orderKey()
+		if blocked[key] {
+			continue
+		}
+		if record.NextAttemptAt.After(now) {
+			blocked[key] = true
+			continue
+		}
+		pending = append(pending, record)
+	}
+	return pending, nil
+}
+
+func (this *MemoryOutboxStore) MarkDelivered(ctx context.Context, id string) error {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	return this.markDelivered(id)
+}
+
+func (this *MemoryOutboxStore) markDelivered(id string) error {
+	i, e := this.find(id)
+	if e != nil {
+		return e
+	}
+	this.records = append(this.records[:i], this.records[i+1:]...)
+	return nil
+}
+
+func (this *MemoryOutboxStore) MarkFailed(ctx context.Context, id string, next time.Time, failure error) error {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	return this.markFailed(id, next, failure)
+}
+
+func (this *MemoryOutboxStore) markFailed(id string, next time.Time, failure error) error {
+	i, e := this.find(id)
+	if e != nil {
+		return e
+	}
+	this.records[i].Attempts++
+	this.records[i].NextAttemptAt = next
+	if failure != nil {
+		this.records[i].LastError = failure.Error()
+	}
+	return nil
+}
+
+func (this *MemoryOutboxStore) find(id string) (int, error) {
+	for i, record := range this.records {
+		if record.Id == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%w: %q", ErrorOutboxRecordNotFound, id)
+}
+
+// NewFileOutboxStore loads records of JSON file, missing file is created on first change
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	store := &FileOutboxStore{path: path}
+	data, readError := os.ReadFile(path)
+	if errors.Is(readError, os.ErrNotExist) {
+		return store, nil
+	}
+	if readError != nil {
+		return nil, readError
+	}
+	state := fileOutboxState{}
+	if e := json.Unmarshal(data, &state); e != nil {
+		return nil, e
+	}
+	store.memory.records = state.Records
+	store.memory.sequence = state.Sequence
+	return store, nil
+}
+
+// FileOutboxStore is MemoryOutboxStore persisted to JSON file after each change
+type FileOutboxStore struct {
+	path   string
+	memory MemoryOutboxStore
+}
+
+type fileOutboxState struct {
+	Sequence int64          `json:"sequence"`
+	Records  []OutboxRecord `json:"records"`
+}
+
+func (this *FileOutboxStore) Add(ctx context.Context, records ...OutboxRecord) error {
+	this.memory.mx.Lock()
+	defer this.memory.mx.Unlock()
+	this.memory.add(records)
+	return this.save()
+}
+
+func (this *FileOutboxStore) Pending(ctx context.Context, now time.Time, limit int) ([]OutboxRecord, error) {
+	return this.memory.Pending(ctx, now, limit)
+}
+
+func (this *FileOutboxStore) MarkDelivered(ctx context.Context, id string) error {
+	this.memory.mx.Lock()
+	defer this.memory.mx.Unlock()
+	if e := this.memory.markDelivered(id); e != nil {
+		return e
+	}
+	return this.save()
+}
+
+func (this *FileOutboxStore) MarkFailed(ctx context.Context, id string, next time.Time, failure error) error {
+	this.memory.mx.Lock()
+	defer this.memory.mx.Unlock()
+	if e := this.memory.markFailed(id, next, failure); e != nil {
+		return e
+	}
+	return this.save()
+}
+
+// save replaces file atomically by renaming temporary one
+func (this *FileOutboxStore) save() error {
+	data, marshalError := json.Marshal(fileOutboxState{
+		Sequence: this.memory.sequence,
+		Records: this.memory.records,
+	})
+	if marshalError != nil {
+		return marshalError
+	}
+	tmp, tmpError := os.CreateTemp(filepath.Dir(this.path), filepath.Base(this.path)+".*")
+	if tmpError != nil {
+		return tmpError
+	}
+	defer os.Remove(tmp.Name())
+	if _, e := tmp.Write(data); e != nil {
+		tmp.Close()
+		return e
+	}
+	if e := tmp.Close(); e != nil {
+		return e
+	}
+	return os.Rename(tmp.Name(), this.path)
+}
@@ -0,0 +1,275 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OutboxRecord is a message stored together with business data
+// and published later by OutboxRelay
+type OutboxRecord struct {
+	Id              string                 `json:"id"`  // assigned by store when empty, used as MessageId
+	Key             string                 `json:"key"` // aggregate key, records of one key are published in order
+
+	Exchange        string                 `json:"exchange"`    // "" - publisher exchange
+	RoutingKey      string                 `json:"routing-key"` // "" - publisher routing key
+	ContentType     string                 `json:"content-type"`
+	ContentEncoding string                 `json:"content-encoding"`
+	Type            string                 `json:"type"`
+	Headers         map[string]interface{} `json:"headers"`
+	Body            []byte                 `json:"body"`
+	CreatedAt       time.Time              `json:"created-at"`
+
+	// relay state
+	Attempts        int                    `json:"attempts"`
+	NextAttemptAt   time.Time              `json:"next-attempt-at"`
+	LastError       string                 `json:"last-error"`
+}
+
+// OutboxStore keeps undelivered records, database backed stores should
+// add records in the same transaction as business writes
+type OutboxStore interface {
+	Add(ctx context.Context, records ...OutboxRecord) error
+	// Pending returns undelivered records in order of adding, records of keys
+	// whose first record waits for NextAttemptAt after now are skipped
+	Pending(ctx context.Context, now time.Time, limit int) ([]OutboxRecord, error)
+	MarkDelivered(ctx context.Context, id string) error
+	// MarkFailed increments record attempts and postpones it till next
+	MarkFailed(ctx context.Context, id string, next time.Time, failure error) error
+}
+
+func NewOutboxRelay(store OutboxStore, publisher *Publisher, cfg ConfigOutbox) (*OutboxRelay, error) {
+	if !publisher.configPublisher.Confirm {
+		return nil, ErrorOutboxConfirmRequired
+	}
+	return newOutboxRelay(
+		store,
+		cfg,
+		func(ctx context.Context, record OutboxRecord) (*Confirmation, error) {
+			return publisher.publish(ctx, record.Body, record.options())
+		},
+		publisher.waitConfirmation,
+	)
+}
+
+func newOutboxRelay(
+	store OutboxStore,
+	cfg ConfigOutbox,
+	publish func(context.Context, OutboxRecord) (*Confirmation, error),
+	wait func(context.Context, *Confirmation) error,
+) (*OutboxRelay, error) {
+	interval, intervalError := time.ParseDuration(cfg.PollInterval)
+	if intervalError != nil {
+		return nil, intervalError
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: poll interval %s", ErrorInvalidInterval, cfg.PollInterval)
+	}
+	b, backoffError := newBackoff(cfg.RetryDelay, cfg.RetryMaxDelay, cfg.RetryMultiplier)
+	if backoffError != nil {
+		return nil, backoffError
+	}
+	return &OutboxRelay{
+		store: store,
+		cfg: cfg,
+		interval: interval,
+		backoff: b,
+		publish: publish,
+		wait: wait,
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+// OutboxRelay publishes pending records with confirms and marks them delivered,
+// failed records are retried with backoff, later records of the same key
+// wait until failed one is delivered
+type OutboxRelay struct {
+	store         OutboxStore
+	cfg           ConfigOutbox
+	interval      time.Duration
+	backoff       backoff
+
+	publish       func(context.Context, OutboxRecord) (*Confirmation, error)
+	wait          func(context.Context, *Confirmation) error
+	errorCallback errorCallback
+
+	mx            sync.Mutex
+	cancel        context.CancelFunc
+	done          chan struct{}
+	notify        chan struct{}
+}
+
+type errorCallback func(e error)
+
+// ErrorCallback receives store errors of background relaying
+func (this *OutboxRelay) ErrorCallback(fn errorCallback) *OutboxRelay {
+	this.errorCallback = fn
+	return this
+}
+
+// Start relays pending records each PollInterval or on Notify until Stop
+func (this *OutboxRelay) Start(ctx context.Context) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.done != nil {
+		return
+	}
+	ctx, this.cancel = context.WithCancel(ctx)
+	this.done = make(chan struct{})
+	go this.loop(ctx, this.done)
+}
+
+// Stop cancels relaying and waits for the current round or ctx
+func (this *OutboxRelay) Stop(ctx context.Context) error {
+	this.mx.Lock()
+	cancel, done := this.cancel, this.done
+	this.cancel, this.done = nil, nil
+	this.mx.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify wakes relay up, e.g. after committed transaction with records
+func (this *OutboxRelay) Notify() {
+	select {
+	case this.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (this *OutboxRelay) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+	for {
+		if _, e := this.Relay(ctx); e != nil && ctx.Err() == nil {
+			if cb := this.errorCallback; cb != nil {
+				cb(e)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-this.notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Relay makes single round over pending records and returns number of delivered,
+// records of different keys are published concurrently, records of one key
+// one by one after confirmation of previous
+func (this *OutboxRelay) Relay(ctx context.Context) (int, error) {
+	now := time.Now()
+	records, pendingError := this.store.Pending(ctx, now, this.cfg.BatchSize)
+	if pendingError != nil {
+		return 0, pendingError
+	}
+
+	queues := map[string][]OutboxRecord{}
+	keys := []string{}
+	blocked := map[string]bool{}
+	for _, record := range records {
+		key := record.orderKey()
+		if blocked[key] {
+			continue
+		}
+		if record.NextAttemptAt.After(now) {
+			blocked[key] = true
+			continue
+		}
+		if _, ok := queues[key]; !ok {
+			keys = append(keys, key)
+		}
+		queues[key] = append(queues[key], record)
+	}
+
+	type inflight struct {
+		key          string
+		record       OutboxRecord
+		confirmation *Confirmation
+		err          error
+	}
+
+	delivered := 0
+	for len(keys) > 0 {
+		wave := make([]inflight, len(keys))
+		for i, key := range keys {
+			record := queues[key][0]
+			confirmation, e := this.publish(ctx, record)
+			wave[i] = inflight{key: key, record: record, confirmation: confirmation, err: e}
+		}
+
+		next := []string{}
+		for _, f := range wave {
+			e := f.err
+			if e == nil {
+				e = this.wait(ctx, f.confirmation)
+			}
+			if ctx.Err() != nil {
+				return delivered, ctx.Err()
+			}
+			if e != nil {
+				attempt := f.record.Attempts + 1
+				if markError := this.store.MarkFailed(ctx, f.record.Id, time.Now().Add(this.backoff.delay(attempt)), e); markError != nil {
+					return delivered, markError
+				}
+				continue
+			}
+			if markError := this.store.MarkDelivered(ctx, f.record.Id); markError != nil {
+				return delivered, markError
+			}
+			delivered++
+			if queues[f.key] = queues[f.key][1:]; len(queues[f.key]) > 0 {
+				next = append(next, f.key)
+			}
+		}
+		keys = next
+	}
+	return delivered, nil
+}
+
+// orderKey is Key, records without key are ordered each by itself
+func (this OutboxRecord) orderKey() string {
+	if this.Key == "" {
+		return "\x00" + this.Id
+	}
+	return this.Key
+}
+
+func (this OutboxRecord) options() []PublishOption {
+	opts := []PublishOption{
+		PubMessageId(this.Id),
+		PubHeaders(this.Headers),
+	}
+	if this.Exchange != "" {
+		opts = append(opts, PubExchange(this.Exchange))
+	}
+	if this.RoutingKey != "" {
+		opts = append(opts, PubRoutingKey(this.RoutingKey))
+	}
+	if this.ContentType != "" {
+		opts = append(opts, PubMessageContentType(this.ContentType))
+	}
+	if this.ContentEncoding != "" {
+		opts = append(opts, PubMessageContentEncoding(this.ContentEncoding))
+	}
+	if this.Type != "" {
+		opts = append(opts, PubType(this.Type))
+	}
+	if !this.CreatedAt.IsZero() {
+		opts = append(opts, PubTimestamp(this.CreatedAt))
+	}
+	return opts
+}
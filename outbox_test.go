@@ -0,0 +1,131 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutboxRelayOrdering(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryOutboxStore()
+	store.Add(ctx,
+		OutboxRecord{Key: "a", Body: []byte("a1")},
+		OutboxRecord{Key: "b", Body: []byte("b1")},
+		OutboxRecord{Key: "a", Body: []byte("a2")},
+		OutboxRecord{Key: "b", Body: []byte("b2")},
+	)
+
+	published := []string{}
+	nacked := map[string]bool{"a1": true}
+	publish := func(ctx context.Context, record OutboxRecord) (*Confirmation, error) {
+		body := string(record.Body)
+		published = append(published, body)
+		if nacked[body] {
+			delete(nacked, body)
+			return resolvedConfirmation(ErrorMessageNacked), nil
+		}
+		return resolvedConfirmation(nil), nil
+	}
+	wait := func(ctx context.Context, c *Confirmation) error {
+		return c.Wait(ctx)
+	}
+
+	cfg := DefaultConfigOutbox
+	cfg.RetryDelay = "0s"
+	relay, e := newOutboxRelay(store, cfg, publish, wait)
+	if e != nil {
+		t.Fatalf("Unexpected relay error: %s", e)
+	}
+
+	delivered, e := relay.Relay(ctx)
+	if e != nil || delivered != 2 {
+		t.Fatalf("Expect 2 delivered records, got %d: %v", delivered, e)
+	}
+	if expected := []string{"a1", "b1", "b2"}; !reflect.DeepEqual(published, expected) {
+		t.Errorf("Expect published %v, got %v", expected, published)
+	}
+
+	pending, _ := store.Pending(ctx, time.Now(), 0)
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("Expect failed a1 to stay pending with attempt, got %+v", pending)
+	}
+
+	published = nil
+	if delivered, e := relay.Relay(ctx); e != nil || delivered != 2 {
+		t.Fatalf("Expect 2 delivered records on retry, got %d: %v", delivered, e)
+	}
+	if expected := []string{"a1", "a2"}; !reflect.DeepEqual(published, expected) {
+		t.Errorf("Expect published %v, got %v", expected, published)
+	}
+}
+
+func TestOutboxRelayBlockedKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryOutboxStore()
+	store.Add(ctx,
+		OutboxRecord{Key: "a", Body: []byte("a1")},
+		OutboxRecord{Key: "a", Body: []byte("a2")},
+		OutboxRecord{Key: "a", Body: []byte("a3")},
+		OutboxRecord{Key: "b", Body: []byte("b1")},
+	)
+	store.MarkFailed(ctx, "1", time.Now().Add(time.Hour), errors.New("nacked"))
+
+	published := []string{}
+	publish := func(ctx context.Context, record OutboxRecord) (*Confirmation, error) {
+		published = append(published, string(record.Body))
+		return resolvedConfirmation(nil), nil
+	}
+	wait := func(ctx context.Context, c *Confirmation) error {
+		return c.Wait(ctx)
+	}
+
+	// batch of blocked key records does not starve other keys
+	cfg := DefaultConfigOutbox
+	cfg.BatchSize = 2
+	relay, e := newOutboxRelay(store, cfg, publish, wait)
+	if e != nil {
+		t.Fatalf("Unexpected relay error: %s", e)
+	}
+	if delivered, e := relay.Relay(ctx); e != nil || delivered != 1 {
+		t.Fatalf("Expect single delivered record, got %d: %v", delivered, e)
+	}
+	if expected := []string{"b1"}; !reflect.DeepEqual(published, expected) {
+		t.Errorf("Expect published %v, got %v", expected, published)
+	}
+
+	cfg.PollInterval = "0s"
+	if _, e := newOutboxRelay(store, cfg, publish, wait); !errors.Is(e, ErrorInvalidInterval) {
+		t.Errorf("Expect ErrorInvalidInterval, got %v", e)
+	}
+}
+
+func TestFileOutboxStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.json")
+
+	store, e := NewFileOutboxStore(path)
+	if e != nil {
+		t.Fatalf("Unexpected store error: %s", e)
+	}
+	store.Add(ctx, OutboxRecord{Key: "a", Body: []byte("a1")}, OutboxRecord{Key: "a", Body: []byte("a2")})
+	if e := store.MarkDelivered(ctx, "1"); e != nil {
+		t.Fatalf("Unexpected mark error: %s", e)
+	}
+	if e := store.MarkDelivered(ctx, "1"); !errors.Is(e, ErrorOutboxRecordNotFound) {
+		t.Errorf("Expect ErrorOutboxRecordNotFound, got %v", e)
+	}
+
+	reloaded, e := NewFileOutboxStore(path)
+	if e != nil {
+		t.Fatalf("Unexpected reload error: %s", e)
+	}
+	reloaded.Add(ctx, OutboxRecord{Key: "a", Body: []byte("a3")})
+	pending, _ := reloaded.Pending(ctx, time.Now(), 0)
+	if len(pending) != 2 || pending[0].Id != "2" || pending[1].Id != "3" {
+		t.Errorf("Expect records 2 and 3 after reload, got %+v", pending)
+	}
+}
@@ -1,12 +1,16 @@
 package rabbitmq
 
 import (
+	"context"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 )
 
 const DEFAULT_MESSAGE_CONTENT_TYPE = "text/plain"
+const ACTOR_HEADER = "x-actor"
 
 type PublishMessage interface {
 	BuildRoutingKey() string
@@ -18,6 +22,8 @@ func NewPublisher() *Publisher {
 	return &Publisher{
 		configConnection: DefaultConfigConnection,
 		configPublisher: DefaultConfigPublisher,
+		configBatch: DefaultConfigBatch,
+		codec: JSONCodec,
 	}
 }
 
@@ -26,11 +32,20 @@ type Publisher struct {
 
 	configConnection ConfigConnection
 	configPublisher  ConfigPublisher
+	configBatch      ConfigBatch
 
-	channel          *amqp091.Channel
+	channel          AMQPChannel // dedicated channel, otherwise pooled ones are used
+	own              bool        // channel is opened by publisher and reopened by Recover
+	dedicated        bool
 	connection       *Connection
+	returnCallback   returnCallback
+
+	codec            Codec
+	encoding         Encoding
 }
 
+type returnCallback func(returned amqp091.Return)
+
 func (this *Publisher) ConfigConnection(cfg ConfigConnection) *Publisher {
 	this.configConnection = cfg
 	return this
@@ -41,34 +56,149 @@ func (this *Publisher) ConfigPublisher(cfg ConfigPublisher) *Publisher {
 	return this
 }
 
+// Codec encodes values of PublishValue, JSONCodec by default
+func (this *Publisher) Codec(codec Codec) *Publisher {
+	this.codec = codec
+	return this
+}
+
+// Encoding compresses encoded values of PublishValue, nil to disable
+func (this *Publisher) Encoding(encoding Encoding) *Publisher {
+	this.encoding = encoding
+	return this
+}
+
+// ReturnCallback receives messages returned by broker as unroutable
+// for own mandatory (or immediate) publishings, it is called
+// asynchronously and returns carry PUBLISH_TAG_HEADER
+func (this *Publisher) ReturnCallback(fn returnCallback) *Publisher {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.returnCallback = fn
+	return this
+}
+
+func (this *Publisher) notifyReturn(returned amqp091.Return) {
+	this.mx.Lock()
+	cb := this.returnCallback
+	this.mx.Unlock()
+	if cb != nil {
+		cb(returned)
+	}
+}
+
+// ConfigBatch limits messages of PublishBatch waiting for confirms at once
+func (this *Publisher) ConfigBatch(cfg ConfigBatch) *Publisher {
+	this.configBatch = cfg
+	return this
+}
+
 func (this *Publisher) SetConnection(connection *Connection) *Publisher {
 	this.connection = connection
 	return this
 }
 
-func (this *Publisher) SetChannel(channel *amqp091.Channel) *Publisher {
+// SetChannel dedicates channel to publisher, publishings are serialized on it,
+// closed channel is not reopened by Recover
+func (this *Publisher) SetChannel(channel AMQPChannel) *Publisher {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	this.channel = channel
+	this.own = false
 	return this
 }
 
+// Dedicated makes publisher open own channel of connection instead of
+// pooled ones, publishings are serialized on it
+func (this *Publisher) Dedicated() *Publisher {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.dedicated = true
+	return this
+}
+
+// Channel returns set or Dedicated channel, by default publisher uses
+// pooled channels of connection and Channel returns ErrorChannelPooled
 func (this *Publisher) Channel() (*amqp091.Channel, error) {
+	return concreteChannel(this.AMQPChannel())
+}
+
+func (this *Publisher) AMQPChannel() (AMQPChannel, error) {
 	this.mx.Lock()
 	defer this.mx.Unlock()
+	return this.dedicatedChannel()
+}
+
+func (this *Publisher) dedicatedChannel() (AMQPChannel, error) {
 	if this.channel == nil {
-		if this.connection == nil {
-			this.connection = NewConnection(this.configConnection)
+		if !this.dedicated {
+			return nil, ErrorChannelPooled
 		}
-		channel, channelError := this.connection.GetChannel()
+		channel, channelError := this.getConnection().GetChannel()
 		if channelError != nil {
 			return nil, channelError
 		}
 		this.channel = channel
+		this.own = true
 	}
 	return this.channel, nil
 }
 
+func (this *Publisher) getConnection() *Connection {
+	if this.connection == nil {
+		this.connection = NewConnection(this.configConnection)
+	}
+	this.connection.Register(this)
+	return this.connection
+}
+
+// acquire returns dedicated channel or checks out pooled one,
+// release must be called after publishing is sent
+func (this *Publisher) acquire(ctx context.Context) (AMQPChannel, *publishTracker, func(), error) {
+	this.mx.Lock()
+	if this.channel != nil || this.dedicated {
+		channel, channelError := this.dedicatedChannel()
+		this.mx.Unlock()
+		if channelError != nil {
+			return nil, nil, nil, channelError
+		}
+		tracker, trackerError := trackerOf(channel)
+		if trackerError != nil {
+			return nil, nil, nil, trackerError
+		}
+		return channel, tracker, func() {}, nil
+	}
+	connection := this.getConnection()
+	this.mx.Unlock()
+
+	channel, checkoutError := connection.Checkout(ctx)
+	if checkoutError != nil {
+		return nil, nil, nil, checkoutError
+	}
+	release := func() {
+		connection.Release(channel)
+	}
+
+	tracker, trackerError := trackerOf(channel)
+	if trackerError != nil {
+		release()
+		return nil, nil, nil, trackerError
+	}
+	return channel, tracker, release, nil
+}
+
+// Recover drops closed own channel, new one is opened on next Publish,
+// trackers are dropped with closed channels
+func (this *Publisher) Recover() error {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.own && this.channel != nil && this.channel.IsClosed() {
+		this.channel = nil
+		this.own = false
+	}
+	return nil
+}
+
 func (this *Publisher) Disconnected(e error) bool {
 	if amqpError, ok := e.(*amqp091.Error); ok && (amqpError.Code == amqp091.ChannelError) {
 		return true
@@ -76,10 +206,84 @@ func (this *Publisher) Disconnected(e error) bool {
 	return false
 }
 
+// Publish waits for broker confirmation in confirm mode,
+// unroutable mandatory messages are reported as ErrorUnroutable
 func (this *Publisher) Publish(body []byte, opts ...PublishOption) error {
-	channel, channelError := this.Channel()
-	if channelError != nil {
-		return channelError
+	confirmation, publishError := this.PublishAsync(body, opts...)
+	if publishError != nil {
+		return publishError
+	}
+	return this.waitConfirmation(context.Background(), confirmation)
+}
+
+// PublishMessage derives routing key and body from msg, stamps publisher
+// actor by WithActor and ACTOR_HEADER, options are applied afterwards
+func (this *Publisher) PublishMessage(ctx context.Context, msg PublishMessage, opts ...PublishOption) error {
+	actor := this.configPublisher.Actor
+	if actor != "" {
+		msg = msg.WithActor(actor)
+	}
+
+	derived := []PublishOption{
+		PubRoutingKey(msg.BuildRoutingKey()),
+		PubMessageBody(msg.EncodePushMessage()),
+	}
+	if actor != "" {
+		derived = append(derived, PubHeader(ACTOR_HEADER, actor))
+	}
+
+	confirmation, publishError := this.publish(ctx, nil, append(derived, opts...))
+	if publishError != nil {
+		return publishError
+	}
+	return this.waitConfirmation(ctx, confirmation)
+}
+
+// PublishValue encodes value with publisher codec and encoding,
+// message content type and encoding are set accordingly
+func (this *Publisher) PublishValue(value interface{}, opts ...PublishOption) error {
+	encoded, encodeError := this.encode(value)
+	if encodeError != nil {
+		return encodeError
+	}
+	return this.Publish(nil, append([]PublishOption{encoded}, opts...)...)
+}
+
+func (this *Publisher) encode(value interface{}) (PublishOption, error) {
+	codec := this.codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+	body, encodeError := codec.Encode(value)
+	if encodeError != nil {
+		return nil, encodeError
+	}
+
+	contentEncoding := ""
+	if this.encoding != nil {
+		if body, encodeError = this.encoding.Encode(body); encodeError != nil {
+			return nil, encodeError
+		}
+		contentEncoding = this.encoding.Name()
+	}
+
+	return func(p *Publish) {
+		p.Message.ContentType = codec.ContentType()
+		p.Message.ContentEncoding = contentEncoding
+		p.Message.Body = body
+	}, nil
+}
+
+// PublishAsync returns confirmation handle, which is already resolved
+// when confirm mode is disabled
+func (this *Publisher) PublishAsync(body []byte, opts ...PublishOption) (*Confirmation, error) {
+	return this.publish(context.Background(), body, opts)
+}
+
+func (this *Publisher) publish(ctx context.Context, body []byte, opts []PublishOption) (*Confirmation, error) {
+	message, messageError := this.defaultMessage(body)
+	if messageError != nil {
+		return nil, messageError
 	}
 
 	publish := Publish{
@@ -87,22 +291,95 @@ func (this *Publisher) Publish(body []byte, opts ...PublishOption) error {
 		RoutingKey: this.configPublisher.RoutingKey,
 		Mandatory: this.configPublisher.Mandatory,
 		Immediate: this.configPublisher.Immediate,
-		Message: amqp091.Publishing{
-			ContentType: DEFAULT_MESSAGE_CONTENT_TYPE,
-			Body: body,
-		},
+		Message: message,
 	}
 	for _, o := range opts {
 		o(&publish)
 	}
 
-	return channel.Publish(
-		publish.Exchange,
-		publish.RoutingKey,
-		publish.Mandatory,
-		publish.Immediate,
-		publish.Message,
-	)
+	channel, tracker, release, channelError := this.acquire(ctx)
+	if channelError != nil {
+		return nil, channelError
+	}
+	defer release()
+
+	send := func(publish Publish) error {
+		return channel.PublishWithContext(
+			ctx,
+			publish.Exchange,
+			publish.RoutingKey,
+			publish.Mandatory,
+			publish.Immediate,
+			publish.Message,
+		)
+	}
+
+	return tracker.publish(channel, publish, this.configPublisher.Confirm, this.notifyReturn, send)
+}
+
+// defaultMessage applies ConfigPublisher publishing defaults,
+// messages are persistent unless DeliveryMode is set to transient
+func (this *Publisher) defaultMessage(body []byte) (amqp091.Publishing, error) {
+	cfg := this.configPublisher
+	message := amqp091.Publishing{
+		ContentType: cfg.ContentType,
+		DeliveryMode: cfg.DeliveryMode,
+		AppId: cfg.AppId,
+		Body: body,
+	}
+	if message.ContentType == "" {
+		message.ContentType = DEFAULT_MESSAGE_CONTENT_TYPE
+	}
+	if message.DeliveryMode == 0 {
+		message.DeliveryMode = amqp091.Persistent
+	}
+	if len(cfg.Headers) > 0 {
+		// copy: options must not modify config headers
+		message.Headers = amqp091.Table{}
+		for name, value := range cfg.Headers {
+			message.Headers[name] = value
+		}
+	}
+	if cfg.Expiration != "" {
+		ttl, ttlError := time.ParseDuration(cfg.Expiration)
+		if ttlError != nil {
+			return message, ttlError
+		}
+		message.Expiration = expiration(ttl)
+	}
+	return message, nil
+}
+
+func (this *Publisher) waitConfirmation(parent context.Context, confirmation *Confirmation) error {
+	ctx, cancel, ctxError := this.confirmContext(parent)
+	if ctxError != nil {
+		return ctxError
+	}
+	defer cancel()
+	return waitConfirmation(parent, ctx, confirmation)
+}
+
+// confirmContext limits parent by ConfigPublisher.ConfirmTimeout
+func (this *Publisher) confirmContext(parent context.Context) (context.Context, context.CancelFunc, error) {
+	t := this.configPublisher.ConfirmTimeout
+	if t == "" {
+		ctx, cancel := context.WithCancel(parent)
+		return ctx, cancel, nil
+	}
+	timeout, timeoutError := time.ParseDuration(t)
+	if timeoutError != nil {
+		return nil, nil, timeoutError
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	return ctx, cancel, nil
+}
+
+func waitConfirmation(parent, ctx context.Context, confirmation *Confirmation) error {
+	e := confirmation.Wait(ctx)
+	if e == context.DeadlineExceeded && parent.Err() == nil {
+		return ErrorConfirmTimeout
+	}
+	return e
 }
 
 type Publish struct {
@@ -117,11 +394,11 @@ type Publish struct {
 
 type PublishOption func(*Publish)
 
-/*func PubExchange(exchange string) PublishOption {
+func PubExchange(exchange string) PublishOption {
 	return func(p *Publish) {
 		p.Exchange = exchange
 	}
-}*/
+}
 func PubRoutingKey(routingKey string) PublishOption {
 	return func(p *Publish) {
 		p.RoutingKey = routingKey
@@ -147,3 +424,94 @@ func PubMessageBody(body []byte) PublishOption {
 		p.Message.Body = body
 	}
 }
+func PubMessageContentEncoding(contentEncoding string) PublishOption {
+	return func(p *Publish) {
+		p.Message.ContentEncoding = contentEncoding
+	}
+}
+// PubHeaders merges headers into message headers
+func PubHeaders(headers amqp091.Table) PublishOption {
+	return func(p *Publish) {
+		for name, value := range headers {
+			PubHeader(name, value)(p)
+		}
+	}
+}
+func PubHeader(name string, value interface{}) PublishOption {
+	return func(p *Publish) {
+		if p.Message.Headers == nil {
+			p.Message.Headers = amqp091.Table{}
+		}
+		p.Message.Headers[name] = value
+	}
+}
+func PubDeliveryMode(deliveryMode uint8) PublishOption {
+	return func(p *Publish) {
+		p.Message.DeliveryMode = deliveryMode
+	}
+}
+func PubPersistent() PublishOption {
+	return PubDeliveryMode(amqp091.Persistent)
+}
+func PubTransient() PublishOption {
+	return PubDeliveryMode(amqp091.Transient)
+}
+func PubPriority(priority uint8) PublishOption {
+	return func(p *Publish) {
+		p.Message.Priority = priority
+	}
+}
+// PubExpiration sets per-message TTL in milliseconds, see expiration
+func PubExpiration(ttl time.Duration) PublishOption {
+	return func(p *Publish) {
+		p.Message.Expiration = expiration(ttl)
+	}
+}
+
+// expiration formats TTL as milliseconds: negative TTL is "0",
+// positive TTL under millisecond is rounded up to "1" to keep it positive
+func expiration(ttl time.Duration) string {
+	switch {
+	case ttl < 0:
+		return "0"
+	case ttl > 0 && ttl < time.Millisecond:
+		return "1"
+	default:
+		return strconv.FormatInt(ttl.Milliseconds(), 10)
+	}
+}
+func PubMessageId(messageId string) PublishOption {
+	return func(p *Publish) {
+		p.Message.MessageId = messageId
+	}
+}
+func PubCorrelationId(correlationId string) PublishOption {
+	return func(p *Publish) {
+		p.Message.CorrelationId = correlationId
+	}
+}
+func PubReplyTo(replyTo string) PublishOption {
+	return func(p *Publish) {
+		p.Message.ReplyTo = replyTo
+	}
+}
+func PubTimestamp(timestamp time.Time) PublishOption {
+	return func(p *Publish) {
+		p.Message.Timestamp = timestamp
+	}
+}
+func PubType(messageType string) PublishOption {
+	return func(p *Publish) {
+		p.Message.Type = messageType
+	}
+}
+func PubUserId(userId string) PublishOption {
+	return func(p *Publish) {
+		p.Message.UserId = userId
+	}
+}
+func PubAppId(appId string) PublishOption {
+	return func(p *Publish) {
+		p.Message.AppId = appId
+	}
+}
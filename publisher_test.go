@@ -0,0 +1,349 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fvaleriy89/rabbitmq/rabbitmqtest"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+var _ AMQPChannel = (*rabbitmqtest.Channel)(nil)
+
+func fakeTopology(t *testing.T, broker *rabbitmqtest.Broker) {
+	topology := NewTopology(ConfigTopology{
+		Exchanges: []ConfigExchange{
+			{Name: "events", Type: amqp091.ExchangeTopic, Durable: true},
+			{Name: "dead", Type: amqp091.ExchangeFanout, Durable: true},
+		},
+		Queues: []ConfigQueue{
+			{Name: "users", Durable: true, Args: map[string]interface{}{"x-dead-letter-exchange": "dead"}},
+			{Name: "users.dead", Durable: true},
+		},
+		Bindings: []ConfigBinding{
+			{Queue: "users", Exchange: "events", RoutingKey: "user.#"},
+			{Queue: "users.dead", Exchange: "dead"},
+		},
+	})
+	if e := topology.SetChannel(broker.Channel()).Declare(); e != nil {
+		t.Fatalf("Unexpected declaration error: %s", e)
+	}
+}
+
+func TestPublishConfirms(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{
+		Exchange: "events",
+		Mandatory: true,
+		Confirm: true,
+		ConfirmTimeout: "1s",
+	})
+	if e := publisher.Publish([]byte("created"), PubRoutingKey("user.created")); e != nil {
+		t.Errorf("Unexpected publish error: %s", e)
+	}
+	if e := publisher.Publish([]byte("created"), PubRoutingKey("order.created")); !errors.Is(e, ErrorUnroutable) {
+		t.Errorf("Expect ErrorUnroutable, got %v", e)
+	}
+
+	messages := broker.Messages("users")
+	if len(messages) != 1 || messages[0].RoutingKey != "user.created" || messages[0].DeliveryMode != amqp091.Persistent {
+		t.Errorf("Expect single persistent user.created message, got %+v", messages)
+	}
+}
+
+func TestPublishReturns(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+	channel := broker.Channel()
+
+	returns := make(chan amqp091.Return, 1)
+	publisher := NewPublisher().SetChannel(channel).ConfigPublisher(ConfigPublisher{
+		Exchange: "events",
+		Mandatory: true,
+		Confirm: true,
+		ConfirmTimeout: "1s",
+	}).ReturnCallback(func(returned amqp091.Return) {
+		returns <- returned
+	})
+
+	// returns of publisher sharing channel are not reported to another one
+	foreign := NewPublisher().SetChannel(channel).ConfigPublisher(ConfigPublisher{
+		Exchange: "events",
+	}).ReturnCallback(func(returned amqp091.Return) {
+		t.Errorf("Unexpected return of another publisher: %+v", returned)
+	})
+	if e := foreign.Publish([]byte("created"), PubRoutingKey("user.created")); e != nil {
+		t.Fatalf("Unexpected publish error: %s", e)
+	}
+
+	if e := publisher.Publish([]byte("created"), PubRoutingKey("order.created"), PubHeader("origin", "test")); !errors.Is(e, ErrorUnroutable) {
+		t.Errorf("Expect ErrorUnroutable, got %v", e)
+	}
+	select {
+	case returned := <-returns:
+		if returned.RoutingKey != "order.created" || returned.Headers["origin"] != "test" || returned.Headers[PUBLISH_TAG_HEADER] == nil {
+			t.Errorf("Expect tagged return of order.created, got %+v", returned)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expect return callback")
+	}
+
+	if e := publisher.Publish([]byte("created"), PubRoutingKey("user.created")); e != nil {
+		t.Errorf("Unexpected publish error: %s", e)
+	}
+}
+
+func TestPublishPooled(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+	connection := NewConnection(DefaultConfigConnection)
+	connection.openChannel = func() (AMQPChannel, error) {
+		return broker.Channel(), nil
+	}
+
+	publisher := NewPublisher().SetConnection(connection).ConfigPublisher(ConfigPublisher{
+		Exchange: "events",
+		Mandatory: true,
+		Confirm: true,
+		ConfirmTimeout: "1s",
+	})
+	if _, e := publisher.AMQPChannel(); !errors.Is(e, ErrorChannelPooled) {
+		t.Errorf("Expect ErrorChannelPooled, got %v", e)
+	}
+	if e := publisher.Publish([]byte("created"), PubRoutingKey("user.created")); e != nil {
+		t.Errorf("Unexpected publish error: %s", e)
+	}
+	if e := publisher.Publish([]byte("created"), PubRoutingKey("order.created")); !errors.Is(e, ErrorUnroutable) {
+		t.Errorf("Expect ErrorUnroutable, got %v", e)
+	}
+	if len(connection.pooled) != 1 || trackerCount(connection.pooled[0]) != 1 {
+		t.Errorf("Expect single pooled channel with tracker, got %d channels", len(connection.pooled))
+	}
+	if messages := broker.Messages("users"); len(messages) != 1 {
+		t.Errorf("Expect single user message, got %+v", messages)
+	}
+}
+
+// interleavedChannel yields between reading sequence number and send
+type interleavedChannel struct {
+	*rabbitmqtest.Channel
+}
+
+func (this interleavedChannel) GetNextPublishSeqNo() uint64 {
+	seq := this.Channel.GetNextPublishSeqNo()
+	time.Sleep(time.Millisecond)
+	return seq
+}
+
+func TestPublishSharedChannel(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+	channel := interleavedChannel{broker.Channel()}
+
+	cfg := ConfigPublisher{Exchange: "events", Mandatory: true, Confirm: true, ConfirmTimeout: "1s"}
+	publishers := []*Publisher{
+		NewPublisher().SetChannel(channel).ConfigPublisher(cfg),
+		NewPublisher().SetChannel(channel).ConfigPublisher(cfg),
+	}
+
+	// publishers share sequence numbers of channel, so confirms and
+	// returns must not be applied to publishings of another one
+	const count = 20
+	wg := sync.WaitGroup{}
+	for p, publisher := range publishers {
+		wg.Add(1)
+		go func(p int, publisher *Publisher) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				key := "user.created"
+				if (i+p)%2 == 0 {
+					key = "order.created"
+				}
+				e := publisher.Publish([]byte(fmt.Sprint(p, i)), PubRoutingKey(key))
+				if unroutable := key == "order.created"; unroutable != errors.Is(e, ErrorUnroutable) {
+					t.Errorf("Publisher %d message %d of %s got %v", p, i, key, e)
+				}
+			}
+		}(p, publisher)
+	}
+	wg.Wait()
+
+	if messages := broker.Messages("users"); len(messages) != count {
+		t.Errorf("Expect %d user messages, got %d", count, len(messages))
+	}
+}
+
+type userMessage struct {
+	key   string
+	actor string
+}
+
+func (this userMessage) BuildRoutingKey() string {
+	return this.key
+}
+
+func (this userMessage) EncodePushMessage() []byte {
+	return []byte(this.key + " by " + this.actor)
+}
+
+func (this userMessage) WithActor(name string) PublishMessage {
+	this.actor = name
+	return this
+}
+
+func TestPublishMessage(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{
+		Exchange: "events",
+		Mandatory: true,
+		Confirm: true,
+		ConfirmTimeout: "1s",
+		Actor: "users-service",
+	})
+	ctx := context.Background()
+	if e := publisher.PublishMessage(ctx, userMessage{key: "user.created"}); e != nil {
+		t.Fatalf("Unexpected publish error: %s", e)
+	}
+	// options are applied over derived routing key, body and actor header
+	if e := publisher.PublishMessage(ctx, userMessage{key: "user.created"},
+		PubRoutingKey("user.deleted"),
+		PubMessageBody([]byte("deleted")),
+		PubHeader(ACTOR_HEADER, "admin"),
+	); e != nil {
+		t.Fatalf("Unexpected publish error: %s", e)
+	}
+	// unroutable message is reported by confirmation
+	if e := publisher.PublishMessage(ctx, userMessage{key: "order.created"}); !errors.Is(e, ErrorUnroutable) {
+		t.Errorf("Expect ErrorUnroutable, got %v", e)
+	}
+
+	messages := broker.Messages("users")
+	if len(messages) != 2 {
+		t.Fatalf("Expect 2 user messages, got %+v", messages)
+	}
+	if m := messages[0]; m.RoutingKey != "user.created" || string(m.Body) != "user.created by users-service" || m.Headers[ACTOR_HEADER] != "users-service" {
+		t.Errorf("Expect message of actor users-service, got %+v", m)
+	}
+	if m := messages[1]; m.RoutingKey != "user.deleted" || string(m.Body) != "deleted" || m.Headers[ACTOR_HEADER] != "admin" {
+		t.Errorf("Expect options to override message, got %+v", m)
+	}
+}
+
+func TestPublishOptions(t *testing.T) {
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name     string
+		option   PublishOption
+		expected func(p *Publish)
+	}{
+		{"exchange", PubExchange("orders"), func(p *Publish) { p.Exchange = "orders" }},
+		{"routing key", PubRoutingKey("order.created"), func(p *Publish) { p.RoutingKey = "order.created" }},
+		{"mandatory", PubMandatory(true), func(p *Publish) { p.Mandatory = true }},
+		{"immediate", PubImmediate(true), func(p *Publish) { p.Immediate = true }},
+		{"content type", PubMessageContentType("text/plain"), func(p *Publish) { p.Message.ContentType = "text/plain" }},
+		{"body", PubMessageBody([]byte("body")), func(p *Publish) { p.Message.Body = []byte("body") }},
+		{"content encoding", PubMessageContentEncoding("gzip"), func(p *Publish) { p.Message.ContentEncoding = "gzip" }},
+		{"headers", PubHeaders(amqp091.Table{"trace": "1", "origin": "test"}), func(p *Publish) {
+			p.Message.Headers = amqp091.Table{"origin": "test", "trace": "1", "tenant": "a"}
+		}},
+		{"header", PubHeader("trace", "1"), func(p *Publish) {
+			p.Message.Headers = amqp091.Table{"origin": "config", "trace": "1", "tenant": "a"}
+		}},
+		{"delivery mode", PubDeliveryMode(amqp091.Transient), func(p *Publish) { p.Message.DeliveryMode = amqp091.Transient }},
+		{"persistent", PubPersistent(), func(p *Publish) { p.Message.DeliveryMode = amqp091.Persistent }},
+		{"transient", PubTransient(), func(p *Publish) { p.Message.DeliveryMode = amqp091.Transient }},
+		{"priority", PubPriority(5), func(p *Publish) { p.Message.Priority = 5 }},
+		{"expiration", PubExpiration(1500 * time.Millisecond), func(p *Publish) { p.Message.Expiration = "1500" }},
+		{"expiration under millisecond", PubExpiration(time.Microsecond), func(p *Publish) { p.Message.Expiration = "1" }},
+		{"zero expiration", PubExpiration(0), func(p *Publish) { p.Message.Expiration = "0" }},
+		{"negative expiration", PubExpiration(-time.Second), func(p *Publish) { p.Message.Expiration = "0" }},
+		{"message id", PubMessageId("42"), func(p *Publish) { p.Message.MessageId = "42" }},
+		{"correlation id", PubCorrelationId("42"), func(p *Publish) { p.Message.CorrelationId = "42" }},
+		{"reply to", PubReplyTo("replies"), func(p *Publish) { p.Message.ReplyTo = "replies" }},
+		{"timestamp", PubTimestamp(timestamp), func(p *Publish) { p.Message.Timestamp = timestamp }},
+		{"type", PubType("user.created"), func(p *Publish) { p.Message.Type = "user.created" }},
+		{"user id", PubUserId("guest"), func(p *Publish) { p.Message.UserId = "guest" }},
+		{"app id", PubAppId("users"), func(p *Publish) { p.Message.AppId = "users" }},
+	}
+
+	base := func() Publish {
+		return Publish{
+			Exchange: "events",
+			RoutingKey: "user.created",
+			Message: amqp091.Publishing{Headers: amqp091.Table{"origin": "config", "tenant": "a"}},
+		}
+	}
+	for _, c := range cases {
+		actual, expected := base(), base()
+		c.option(&actual)
+		c.expected(&expected)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Option %s expect %+v, got %+v", c.name, expected, actual)
+		}
+	}
+}
+
+func TestPublishDefaults(t *testing.T) {
+	headers := map[string]interface{}{"origin": "config"}
+	cfg := ConfigPublisher{
+		Exchange: "events",
+		RoutingKey: "user.created",
+		AppId: "users",
+		Headers: headers,
+		Expiration: "1500ms",
+	}
+
+	message, e := NewPublisher().ConfigPublisher(cfg).defaultMessage([]byte("created"))
+	if e != nil {
+		t.Fatalf("Unexpected message error: %s", e)
+	}
+	expected := amqp091.Publishing{
+		ContentType: DEFAULT_MESSAGE_CONTENT_TYPE,
+		DeliveryMode: amqp091.Persistent,
+		AppId: "users",
+		Headers: amqp091.Table{"origin": "config"},
+		Expiration: "1500",
+		Body: []byte("created"),
+	}
+	if !reflect.DeepEqual(message, expected) {
+		t.Errorf("Expect default message %+v, got %+v", expected, message)
+	}
+
+	invalid := cfg
+	invalid.Expiration = "soon"
+	if _, e := NewPublisher().ConfigPublisher(invalid).defaultMessage(nil); e == nil {
+		t.Errorf("Expect error of invalid expiration")
+	}
+
+	// per-call options override defaults without changing config headers
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(cfg)
+	if e := publisher.Publish([]byte("created"),
+		PubHeader("origin", "call"),
+		PubAppId("admin"),
+		PubTransient(),
+		PubMessageContentType("text/csv"),
+	); e != nil {
+		t.Fatalf("Unexpected publish error: %s", e)
+	}
+	messages := broker.Messages("users")
+	if len(messages) != 1 {
+		t.Fatalf("Expect single user message, got %+v", messages)
+	}
+	if m := messages[0]; m.Headers["origin"] != "call" || m.AppId != "admin" || m.DeliveryMode != amqp091.Transient || m.ContentType != "text/csv" {
+		t.Errorf("Expect options to override defaults, got %+v", m)
+	}
+	if headers["origin"] != "config" || len(headers) != 1 {
+		t.Errorf("Expect config headers to stay unchanged, got %v", headers)
+	}
+}
@@ -1,6 +1,7 @@
 package rabbitmq
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/rabbitmq/amqp091-go"
@@ -19,7 +20,8 @@ type Queue struct {
 	configQueue      ConfigQueue
 
 	connection       *Connection
-	channel          *amqp091.Channel
+	channel          AMQPChannel
+	declared         bool
 }
 
 func (this *Queue) ConfigQueue(cfg ConfigQueue) *Queue {
@@ -37,7 +39,7 @@ func (this *Queue) SetConnection(connection *Connection) *Queue {
 	return this
 }
 
-func (this *Queue) SetChannel(channel *amqp091.Channel) *Queue {
+func (this *Queue) SetChannel(channel AMQPChannel) *Queue {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	this.channel = channel
@@ -45,6 +47,10 @@ func (this *Queue) SetChannel(channel *amqp091.Channel) *Queue {
 }
 
 func (this *Queue) Channel() (*amqp091.Channel, error) {
+	return concreteChannel(this.AMQPChannel())
+}
+
+func (this *Queue) AMQPChannel() (AMQPChannel, error) {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	if this.channel == nil {
@@ -55,13 +61,14 @@ func (this *Queue) Channel() (*amqp091.Channel, error) {
 		if channelError != nil {
 			return nil, channelError
 		}
+		this.connection.Register(this)
 		this.channel = channel
 	}
 	return this.channel, nil
 }
 
 func (this *Queue) Declare() (*amqp091.Queue, error) {
-	channel, channelError := this.Channel()
+	channel, channelError := this.AMQPChannel()
 	if channelError != nil {
 		return nil, channelError
 	}
@@ -70,7 +77,12 @@ func (this *Queue) Declare() (*amqp091.Queue, error) {
                 return nil, e
         }
 
-	queue, queueError := channel.QueueDeclare(
+	declare := channel.QueueDeclare
+	if this.configQueue.Passive {
+		declare = channel.QueueDeclarePassive
+	}
+
+	queue, queueError := declare(
 		this.configQueue.Name,
 		this.configQueue.Durable,
 		this.configQueue.AutoDelete,
@@ -78,14 +90,35 @@ func (this *Queue) Declare() (*amqp091.Queue, error) {
 		this.configQueue.NoWait,
 		this.configQueue.Args,
 	)
+	if queueError != nil && this.configQueue.Passive {
+		return nil, fmt.Errorf("%w: queue %q: %w", ErrorPassiveDeclaration, this.configQueue.Name, queueError)
+	}
 	if queueError != nil {
 		return nil, queueError
 	}
+
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.declared = true
 	return &queue, nil
 }
 
+// Recover reopens channel and redeclares queue after reconnection
+func (this *Queue) Recover() error {
+	this.mx.Lock()
+	this.channel = nil
+	declared := this.declared
+	this.mx.Unlock()
+
+	if !declared {
+		return nil
+	}
+	_, e := this.Declare()
+	return e
+}
+
 func (this *Queue) GetInfo() (*amqp091.Queue, error) {
-	channel, channelError := this.Channel()
+	channel, channelError := this.AMQPChannel()
 	if channelError != nil {
 		return nil, channelError
 	}
@@ -97,7 +130,7 @@ func (this *Queue) GetInfo() (*amqp091.Queue, error) {
 }
 
 func (this *Queue) Purge() (int, error) {
-	channel, channelError := this.Channel()
+	channel, channelError := this.AMQPChannel()
 	if channelError != nil {
 		return 0, channelError
 	}
@@ -6,38 +6,39 @@ const STAR = "*"
 const HASH = "#"
 const SEPR = "."
 
+// MatchKey follows broker topic exchange routing: "*" matches exactly one
+// word, "#" matches zero or more words, empty words are allowed
 func MatchKey(required, check string) bool {
-	return matchParts(
-		strings.Split(required, SEPR),
-		strings.Split(check, SEPR),
+	return matchWords(
+		splitWords(required),
+		splitWords(check),
 	)
 }
 
-func matchParts(needle, stack []string) bool {
-	if len(needle) == 0 {
-		return (len(stack) == 0)
-	}
-	if len(stack) == 0 {
-		return false
-	}
-
-	switch needle[0] {
-	case stack[0]:
-		return matchParts(needle[1:], stack[1:])
-	case STAR:
-		return matchParts(needle[1:], stack[1:])
-	case HASH:
-		return matchPartsHash(needle[1:], stack[1:])
-	default:
-		return false
+// splitWords as broker does: empty key has no words, "a." is ["a", ""]
+func splitWords(key string) []string {
+	if key == "" {
+		return nil
 	}
+	return strings.Split(key, SEPR)
 }
 
-func matchPartsHash(needle, stack []string) bool {
-	for i := len(stack); i >= 0; i-- {
-		if matchParts(needle, stack[i:]) {
-			return true
+// matchWords is O(len(needle)*len(stack)):
+// reached[i] means matched needle prefix consumes stack[:i]
+func matchWords(needle, stack []string) bool {
+	reached := make([]bool, len(stack)+1)
+	reached[0] = true
+	for _, word := range needle {
+		next := make([]bool, len(stack)+1)
+		for i := range next {
+			switch {
+			case word == HASH:
+				next[i] = reached[i] || (i > 0 && next[i-1])
+			case i > 0 && reached[i-1]:
+				next[i] = word == STAR || word == stack[i-1]
+			}
 		}
+		reached = next
 	}
-	return false
+	return reached[len(stack)]
 }
@@ -0,0 +1,900 @@
+// Package rabbitmqtest provides in-memory rabbitmq broker for tests
+package rabbitmqtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// NewBroker creates in-memory broker with default and "amq." exchanges
+func NewBroker() *Broker {
+	broker := &Broker{
+		exchanges: make(map[string]*fakeExchange),
+		queues: make(map[string]*fakeQueue),
+	}
+	predeclared := map[string]string{
+		"": amqp091.ExchangeDirect,
+		"amq.direct": amqp091.ExchangeDirect,
+		"amq.fanout": amqp091.ExchangeFanout,
+		"amq.topic": amqp091.ExchangeTopic,
+		"amq.headers": amqp091.ExchangeHeaders,
+		"amq.match": amqp091.ExchangeHeaders,
+	}
+	for name, kind := range predeclared {
+		broker.exchanges[name] = &fakeExchange{name: name, kind: kind, durable: true}
+	}
+	return broker
+}
+
+// Broker emulates rabbitmq for tests: exchanges of all four types,
+// queue bindings, consumers with prefetch, acks, requeues, dead-lettering
+// with message TTL, publisher confirms and returns of mandatory messages.
+// Channel errors close the channel like rabbitmq does.
+type Broker struct {
+	mx        sync.Mutex
+	exchanges map[string]*fakeExchange
+	queues    map[string]*fakeQueue
+	sequence  int // generated queue names and consumer tags
+}
+
+type fakeExchange struct {
+	name       string
+	kind       string
+	durable    bool
+	autoDelete bool
+	internal   bool
+	bindings   []fakeBinding
+}
+
+type fakeBinding struct {
+	queue string
+	key   string
+	args  amqp091.Table
+}
+
+type fakeQueue struct {
+	name       string
+	durable    bool
+	autoDelete bool
+	exclusive  bool
+	args       amqp091.Table
+	ready      []*fakeMessage
+	consumers  []*fakeConsumer
+	next       int // round robin position
+}
+
+type fakeMessage struct {
+	exchange    string
+	routingKey  string
+	publishing  amqp091.Publishing
+	redelivered bool
+}
+
+type fakeConsumer struct {
+	tag       string
+	channel   *Channel
+	queue     *fakeQueue
+	autoAck   bool
+	exclusive bool
+	prefetch  int
+	unacked   int
+
+	deliveries chan amqp091.Delivery
+	events     *fakeEvents // deliveries in order
+}
+
+type fakeUnacked struct {
+	consumer *fakeConsumer
+	message  *fakeMessage
+}
+
+// Channel opens new channel to broker
+func (this *Broker) Channel() *Channel {
+	return &Channel{
+		broker: this,
+		consumers: make(map[string]*fakeConsumer),
+		unacked: make(map[uint64]*fakeUnacked),
+		events: newFakeEvents(),
+	}
+}
+
+// Messages returns copies of messages ready for delivery in queue
+func (this *Broker) Messages(queue string) []amqp091.Delivery {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	q, ok := this.queues[queue]
+	if !ok {
+		return nil
+	}
+	deliveries := make([]amqp091.Delivery, len(q.ready))
+	for i, msg := range q.ready {
+		deliveries[i] = msg.delivery()
+	}
+	return deliveries
+}
+
+func (this *Broker) route(exchange *fakeExchange, key string, headers amqp091.Table) []*fakeQueue {
+	if exchange.name == "" {
+		if q, ok := this.queues[key]; ok {
+			return []*fakeQueue{q}
+		}
+		return nil
+	}
+
+	routed := []*fakeQueue{}
+	seen := map[string]bool{}
+	for _, b := range exchange.bindings {
+		if seen[b.queue] || !b.matches(exchange.kind, key, headers) {
+			continue
+		}
+		if q, ok := this.queues[b.queue]; ok {
+			seen[b.queue] = true
+			routed = append(routed, q)
+		}
+	}
+	return routed
+}
+
+func (this fakeBinding) matches(kind, key string, headers amqp091.Table) bool {
+	switch kind {
+	case amqp091.ExchangeFanout:
+		return true
+	case amqp091.ExchangeTopic:
+		return matchTopic(splitWords(this.key), splitWords(key))
+	case amqp091.ExchangeHeaders:
+		return matchHeaders(this.args, headers)
+	default:
+		return this.key == key
+	}
+}
+
+func splitWords(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, ".")
+}
+
+// matchTopic of pattern words with "*" and "#" against key words,
+// reached[i] means matched pattern prefix consumes key[:i]
+func matchTopic(pattern, key []string) bool {
+	reached := make([]bool, len(key)+1)
+	reached[0] = true
+	for _, word := range pattern {
+		next := make([]bool, len(key)+1)
+		for i := range next {
+			switch {
+			case word == "#":
+				next[i] = reached[i] || (i > 0 && next[i-1])
+			case i > 0 && reached[i-1]:
+				next[i] = word == "*" || word == key[i-1]
+			}
+		}
+		reached = next
+	}
+	return reached[len(key)]
+}
+
+// matchHeaders compares binding arguments except "x-" ones with message
+// headers by x-match "all" (default) or "any"
+func matchHeaders(args, headers amqp091.Table) bool {
+	any := args["x-match"] == "any"
+	total, matched := 0, 0
+	for name, value := range args {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		total++
+		header, ok := headers[name]
+		if ok && (value == nil || fmt.Sprint(header) == fmt.Sprint(value)) {
+			matched++
+		}
+	}
+	if any {
+		return matched > 0
+	}
+	return matched == total
+}
+
+// enqueue adds message copy to queue, schedules TTL expiration
+// and dispatches it to consumers
+func (this *Broker) enqueue(q *fakeQueue, exchange, key string, publishing amqp091.Publishing) {
+	msg := &fakeMessage{
+		exchange: exchange,
+		routingKey: key,
+		publishing: publishing,
+	}
+	if publishing.Headers != nil {
+		msg.publishing.Headers = amqp091.Table{}
+		for name, value := range publishing.Headers {
+			msg.publishing.Headers[name] = value
+		}
+	}
+	q.ready = append(q.ready, msg)
+
+	if ttl, ok := messageTTL(q, publishing); ok {
+		time.AfterFunc(ttl, func() {
+			this.expire(q, msg)
+		})
+	}
+	this.dispatch(q)
+}
+
+func messageTTL(q *fakeQueue, publishing amqp091.Publishing) (time.Duration, bool) {
+	ttl, ok := int64(0), false
+	if value, found := q.args["x-message-ttl"]; found {
+		ttl, ok = integerArg(value)
+	}
+	if publishing.Expiration != "" {
+		if expiration, e := strconv.ParseInt(publishing.Expiration, 10, 64); e == nil && (!ok || expiration < ttl) {
+			ttl, ok = expiration, true
+		}
+	}
+	return time.Duration(ttl) * time.Millisecond, ok
+}
+
+func integerArg(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func (this *Broker) expire(q *fakeQueue, msg *fakeMessage) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	for i, ready := range q.ready {
+		if ready == msg {
+			q.ready = append(q.ready[:i], q.ready[i+1:]...)
+			this.deadLetter(q, msg)
+			return
+		}
+	}
+}
+
+// deadLetter republishes message to queue x-dead-letter-exchange,
+// message is dropped when queue has no one
+func (this *Broker) deadLetter(q *fakeQueue, msg *fakeMessage) {
+	name, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	exchange, ok := this.exchanges[name]
+	if !ok {
+		return
+	}
+	key := msg.routingKey
+	if dlk, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		key = dlk
+	}
+	publishing := msg.publishing
+	publishing.Expiration = ""
+	for _, target := range this.route(exchange, key, publishing.Headers) {
+		this.enqueue(target, name, key, publishing)
+	}
+}
+
+func (this *Broker) dispatch(q *fakeQueue) {
+	for len(q.ready) > 0 {
+		consumer := q.nextConsumer()
+		if consumer == nil {
+			return
+		}
+		msg := q.ready[0]
+		q.ready = q.ready[1:]
+		consumer.deliver(msg)
+	}
+}
+
+func (this *fakeQueue) nextConsumer() *fakeConsumer {
+	for i := 0; i < len(this.consumers); i++ {
+		consumer := this.consumers[(this.next+i)%len(this.consumers)]
+		if consumer.autoAck || consumer.prefetch == 0 || consumer.unacked < consumer.prefetch {
+			this.next = (this.next + i + 1) % len(this.consumers)
+			return consumer
+		}
+	}
+	return nil
+}
+
+func (this *fakeQueue) info() amqp091.Queue {
+	return amqp091.Queue{
+		Name: this.name,
+		Messages: len(this.ready),
+		Consumers: len(this.consumers),
+	}
+}
+
+func (this *fakeConsumer) deliver(msg *fakeMessage) {
+	channel := this.channel
+	channel.deliveryTag++
+	delivery := msg.delivery()
+	delivery.Acknowledger = channel
+	delivery.ConsumerTag = this.tag
+	delivery.DeliveryTag = channel.deliveryTag
+
+	if !this.autoAck {
+		channel.unacked[delivery.DeliveryTag] = &fakeUnacked{consumer: this, message: msg}
+		this.unacked++
+	}
+
+	deliveries := this.deliveries
+	this.events.push(func() {
+		deliveries <- delivery
+	})
+}
+
+func (this *fakeMessage) delivery() amqp091.Delivery {
+	p := this.publishing
+	return amqp091.Delivery{
+		Headers: p.Headers,
+		ContentType: p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		DeliveryMode: p.DeliveryMode,
+		Priority: p.Priority,
+		CorrelationId: p.CorrelationId,
+		ReplyTo: p.ReplyTo,
+		Expiration: p.Expiration,
+		MessageId: p.MessageId,
+		Timestamp: p.Timestamp,
+		Type: p.Type,
+		UserId: p.UserId,
+		AppId: p.AppId,
+		Redelivered: this.redelivered,
+		Exchange: this.exchange,
+		RoutingKey: this.routingKey,
+		Body: p.Body,
+	}
+}
+
+// Channel implements rabbitmq.AMQPChannel and amqp091.Acknowledger of its deliveries
+type Channel struct {
+	broker      *Broker
+
+	// guarded by broker mutex
+	closed      bool
+	confirm     bool
+	published   uint64
+	deliveryTag uint64
+	prefetch    int
+	consumers   map[string]*fakeConsumer
+	unacked     map[uint64]*fakeUnacked
+	publishes   []chan amqp091.Confirmation
+	returns     []chan amqp091.Return
+
+	events      *fakeEvents // confirms and returns in publishing order
+}
+
+var _ amqp091.Acknowledger = (*Channel)(nil)
+
+// fail closes channel by error like rabbitmq channel exception
+func (this *Channel) fail(code int, format string, args ...interface{}) error {
+	e := &amqp091.Error{
+		Code: code,
+		Reason: fmt.Sprintf(format, args...),
+		Server: true,
+	}
+	this.close()
+	return e
+}
+
+func (this *Channel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error {
+	return this.exchangeDeclare(false, name, kind, durable, autoDelete, internal)
+}
+
+func (this *Channel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error {
+	return this.exchangeDeclare(true, name, kind, durable, autoDelete, internal)
+}
+
+func (this *Channel) exchangeDeclare(passive bool, name, kind string, durable, autoDelete, internal bool) error {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.ErrClosed
+	}
+
+	exchange, exists := this.broker.exchanges[name]
+	switch {
+	case passive && !exists:
+		return this.fail(amqp091.NotFound, "no exchange '%s'", name)
+	case passive:
+		return nil
+	case exists && (exchange.kind != kind || exchange.durable != durable || exchange.autoDelete != autoDelete || exchange.internal != internal):
+		return this.fail(amqp091.PreconditionFailed, "inequivalent arg for exchange '%s'", name)
+	case exists:
+		return nil
+	case name == "" || strings.HasPrefix(name, "amq."):
+		return this.fail(amqp091.AccessRefused, "exchange name '%s' contains reserved prefix 'amq.*'", name)
+	}
+
+	switch kind {
+	case amqp091.ExchangeDirect, amqp091.ExchangeFanout, amqp091.ExchangeTopic, amqp091.ExchangeHeaders:
+	default:
+		return this.fail(amqp091.CommandInvalid, "unknown exchange type '%s'", kind)
+	}
+
+	this.broker.exchanges[name] = &fakeExchange{
+		name: name,
+		kind: kind,
+		durable: durable,
+		autoDelete: autoDelete,
+		internal: internal,
+	}
+	return nil
+}
+
+func (this *Channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error) {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.Queue{}, amqp091.ErrClosed
+	}
+
+	if name == "" {
+		this.broker.sequence++
+		name = fmt.Sprintf("amq.gen-%d", this.broker.sequence)
+	}
+	if q, exists := this.broker.queues[name]; exists {
+		if q.durable != durable || q.autoDelete != autoDelete || q.exclusive != exclusive {
+			return amqp091.Queue{}, this.fail(amqp091.PreconditionFailed, "inequivalent arg for queue '%s'", name)
+		}
+		return q.info(), nil
+	}
+
+	q := &fakeQueue{
+		name: name,
+		durable: durable,
+		autoDelete: autoDelete,
+		exclusive: exclusive,
+		args: args,
+	}
+	this.broker.queues[name] = q
+	return q.info(), nil
+}
+
+func (this *Channel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error) {
+	return this.QueueInspect(name)
+}
+
+func (this *Channel) QueueInspect(name string) (amqp091.Queue, error) {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	q, e := this.queue(name)
+	if e != nil {
+		return amqp091.Queue{}, e
+	}
+	return q.info(), nil
+}
+
+func (this *Channel) queue(name string) (*fakeQueue, error) {
+	if this.closed {
+		return nil, amqp091.ErrClosed
+	}
+	q, exists := this.broker.queues[name]
+	if !exists {
+		return nil, this.fail(amqp091.NotFound, "no queue '%s'", name)
+	}
+	return q, nil
+}
+
+func (this *Channel) QueuePurge(name string, noWait bool) (int, error) {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	q, e := this.queue(name)
+	if e != nil {
+		return 0, e
+	}
+	purged := len(q.ready)
+	q.ready = nil
+	return purged, nil
+}
+
+func (this *Channel) QueueBind(name, key, exchange string, noWait bool, args amqp091.Table) error {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if _, e := this.queue(name); e != nil {
+		return e
+	}
+	x, exists := this.broker.exchanges[exchange]
+	switch {
+	case !exists:
+		return this.fail(amqp091.NotFound, "no exchange '%s'", exchange)
+	case exchange == "":
+		return this.fail(amqp091.AccessRefused, "operation not permitted on the default exchange")
+	}
+
+	binding := fakeBinding{queue: name, key: key, args: args}
+	for _, b := range x.bindings {
+		if b.queue == name && b.key == key && fmt.Sprint(b.args) == fmt.Sprint(args) {
+			return nil
+		}
+	}
+	x.bindings = append(x.bindings, binding)
+	return nil
+}
+
+// Qos prefetch count is applied to consumers started afterwards
+func (this *Channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.ErrClosed
+	}
+	this.prefetch = prefetchCount
+	return nil
+}
+
+func (this *Channel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp091.Table) (<-chan amqp091.Delivery, error) {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	q, e := this.queue(queue)
+	if e != nil {
+		return nil, e
+	}
+
+	if consumer == "" {
+		this.broker.sequence++
+		consumer = fmt.Sprintf("ctag-%d", this.broker.sequence)
+	}
+	if _, exists := this.consumers[consumer]; exists {
+		return nil, this.fail(amqp091.NotAllowed, "attempt to reuse consumer tag '%s'", consumer)
+	}
+	for _, c := range q.consumers {
+		if exclusive || c.exclusive {
+			return nil, this.fail(amqp091.AccessRefused, "queue '%s' in exclusive use", queue)
+		}
+	}
+
+	c := &fakeConsumer{
+		tag: consumer,
+		channel: this,
+		queue: q,
+		autoAck: autoAck,
+		exclusive: exclusive,
+		prefetch: this.prefetch,
+		deliveries: make(chan amqp091.Delivery),
+		events: newFakeEvents(),
+	}
+	this.consumers[consumer] = c
+	q.consumers = append(q.consumers, c)
+	this.broker.dispatch(q)
+	return c.deliveries, nil
+}
+
+func (this *Channel) Cancel(consumer string, noWait bool) error {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.ErrClosed
+	}
+	if c, exists := this.consumers[consumer]; exists {
+		this.cancel(c)
+	}
+	return nil
+}
+
+// cancel stops deliveries to consumer, auto-delete queue is deleted
+// with its last consumer
+func (this *Channel) cancel(c *fakeConsumer) {
+	delete(this.consumers, c.tag)
+	q := c.queue
+	for i, consumer := range q.consumers {
+		if consumer == c {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	if q.autoDelete && len(q.consumers) == 0 {
+		this.broker.deleteQueue(q)
+	}
+
+	deliveries := c.deliveries
+	c.events.close(func() {
+		close(deliveries)
+	})
+}
+
+func (this *Broker) deleteQueue(q *fakeQueue) {
+	delete(this.queues, q.name)
+	for _, exchange := range this.exchanges {
+		bindings := exchange.bindings[:0]
+		for _, b := range exchange.bindings {
+			if b.queue != q.name {
+				bindings = append(bindings, b)
+			}
+		}
+		exchange.bindings = bindings
+	}
+}
+
+func (this *Channel) Confirm(noWait bool) error {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.ErrClosed
+	}
+	this.confirm = true
+	return nil
+}
+
+func (this *Channel) NotifyPublish(confirm chan amqp091.Confirmation) chan amqp091.Confirmation {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		close(confirm)
+		return confirm
+	}
+	this.publishes = append(this.publishes, confirm)
+	return confirm
+}
+
+func (this *Channel) NotifyReturn(returns chan amqp091.Return) chan amqp091.Return {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		close(returns)
+		return returns
+	}
+	this.returns = append(this.returns, returns)
+	return returns
+}
+
+func (this *Channel) GetNextPublishSeqNo() uint64 {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	return this.published + 1
+}
+
+func (this *Channel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error {
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.ErrClosed
+	}
+
+	x, exists := this.broker.exchanges[exchange]
+	switch {
+	case !exists:
+		return this.fail(amqp091.NotFound, "no exchange '%s'", exchange)
+	case x.internal:
+		return this.fail(amqp091.AccessRefused, "cannot publish to internal exchange '%s'", exchange)
+	case immediate:
+		return this.fail(amqp091.NotImplemented, "immediate=true")
+	}
+
+	msg.Body = append([]byte(nil), msg.Body...)
+	queues := this.broker.route(x, key, msg.Headers)
+	for _, q := range queues {
+		this.broker.enqueue(q, exchange, key, msg)
+	}
+
+	if len(queues) == 0 && mandatory {
+		returned := amqp091.Return{
+			ReplyCode: amqp091.NoRoute,
+			ReplyText: "NO_ROUTE",
+			Exchange: exchange,
+			RoutingKey: key,
+			ContentType: msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode: msg.DeliveryMode,
+			Priority: msg.Priority,
+			CorrelationId: msg.CorrelationId,
+			ReplyTo: msg.ReplyTo,
+			Expiration: msg.Expiration,
+			MessageId: msg.MessageId,
+			Timestamp: msg.Timestamp,
+			Type: msg.Type,
+			UserId: msg.UserId,
+			AppId: msg.AppId,
+			Headers: msg.Headers,
+			Body: msg.Body,
+		}
+		listeners := append([]chan amqp091.Return(nil), this.returns...)
+		this.events.push(func() {
+			for _, l := range listeners {
+				l <- returned
+			}
+		})
+	}
+
+	if this.confirm {
+		this.published++
+		confirmation := amqp091.Confirmation{DeliveryTag: this.published, Ack: true}
+		listeners := append([]chan amqp091.Confirmation(nil), this.publishes...)
+		this.events.push(func() {
+			for _, l := range listeners {
+				l <- confirmation
+			}
+		})
+	}
+	return nil
+}
+
+func (this *Channel) IsClosed() bool {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	return this.closed
+}
+
+func (this *Channel) Close() error {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.ErrClosed
+	}
+	this.close()
+	return nil
+}
+
+// close cancels consumers, requeues unacknowledged messages
+// and closes notification channels after pending notifications
+func (this *Channel) close() {
+	this.closed = true
+	for _, c := range this.consumers {
+		this.cancel(c)
+	}
+	tags := make([]uint64, 0, len(this.unacked))
+	for tag := range this.unacked {
+		tags = append(tags, tag)
+	}
+	// requeued to the head of queue: the latest first
+	sort.Slice(tags, func(i, j int) bool { return tags[i] > tags[j] })
+	for _, tag := range tags {
+		this.settle(tag, false, true)
+	}
+
+	publishes, returns := this.publishes, this.returns
+	this.publishes, this.returns = nil, nil
+	this.events.close(func() {
+		for _, l := range publishes {
+			close(l)
+		}
+		for _, l := range returns {
+			close(l)
+		}
+	})
+}
+
+func (this *Channel) Ack(tag uint64, multiple bool) error {
+	return this.acknowledge(tag, multiple, true, false)
+}
+
+func (this *Channel) Nack(tag uint64, multiple bool, requeue bool) error {
+	return this.acknowledge(tag, multiple, false, requeue)
+}
+
+func (this *Channel) Reject(tag uint64, requeue bool) error {
+	return this.acknowledge(tag, false, false, requeue)
+}
+
+func (this *Channel) acknowledge(tag uint64, multiple, ack, requeue bool) error {
+	this.broker.mx.Lock()
+	defer this.broker.mx.Unlock()
+	if this.closed {
+		return amqp091.ErrClosed
+	}
+	if _, exists := this.unacked[tag]; !exists {
+		return this.fail(amqp091.PreconditionFailed, "unknown delivery tag %d", tag)
+	}
+
+	tags := []uint64{tag}
+	if multiple {
+		tags = tags[:0]
+		for t := range this.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+	}
+	for _, t := range tags {
+		this.settle(t, ack, requeue)
+	}
+	return nil
+}
+
+// settle removes unacknowledged message, nacked one is requeued to the head
+// of queue or dead-lettered
+func (this *Channel) settle(tag uint64, ack, requeue bool) {
+	unacked := this.unacked[tag]
+	delete(this.unacked, tag)
+	unacked.consumer.unacked--
+	q := unacked.consumer.queue
+	if _, exists := this.broker.queues[q.name]; !exists {
+		return
+	}
+
+	switch {
+	case ack:
+	case requeue:
+		unacked.message.redelivered = true
+		q.ready = append([]*fakeMessage{unacked.message}, q.ready...)
+	default:
+		this.broker.deadLetter(q, unacked.message)
+	}
+	this.broker.dispatch(q)
+}
+
+// fakeEvents runs pushed functions one by one in background,
+// so broker never blocks on channels read by its callers
+type fakeEvents struct {
+	mx     sync.Mutex
+	queue  []func()
+	signal chan struct{}
+	closed bool
+}
+
+func newFakeEvents() *fakeEvents {
+	events := &fakeEvents{signal: make(chan struct{}, 1)}
+	go events.run()
+	return events
+}
+
+func (this *fakeEvents) push(fn func()) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.closed {
+		return
+	}
+	this.queue = append(this.queue, fn)
+	select {
+	case this.signal <- struct{}{}:
+	default:
+	}
+}
+
+// close runs fn after pushed functions and stops
+func (this *fakeEvents) close(fn func()) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.closed {
+		return
+	}
+	this.closed = true
+	this.queue = append(this.queue, func() {
+		fn()
+		this.mx.Lock()
+		defer this.mx.Unlock()
+		close(this.signal)
+	})
+	select {
+	case this.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (this *fakeEvents) run() {
+	for range this.signal {
+		for {
+			this.mx.Lock()
+			if len(this.queue) == 0 {
+				this.mx.Unlock()
+				break
+			}
+			fn := this.queue[0]
+			this.queue = this.queue[1:]
+			this.mx.Unlock()
+			fn()
+		}
+	}
+}
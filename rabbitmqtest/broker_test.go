@@ -0,0 +1,25 @@
+package rabbitmqtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestHeadersExchange(t *testing.T) {
+	broker := NewBroker()
+	channel := broker.Channel()
+	channel.QueueDeclare("audit", true, false, false, false, nil)
+	channel.QueueBind("audit", "", "amq.headers", false, amqp091.Table{"x-match": "any", "type": "audit", "level": "high"})
+
+	channel.PublishWithContext(context.Background(), "amq.headers", "", false, false, amqp091.Publishing{Headers: amqp091.Table{"level": "high"}})
+	channel.PublishWithContext(context.Background(), "amq.headers", "", false, false, amqp091.Publishing{Headers: amqp091.Table{"level": "low"}})
+	if messages := broker.Messages("audit"); len(messages) != 1 {
+		t.Errorf("Expect one matched message, got %d", len(messages))
+	}
+
+	if e := channel.ExchangeDeclarePassive("missing", amqp091.ExchangeTopic, true, false, false, false, nil); e == nil || !channel.IsClosed() {
+		t.Errorf("Expect passive declaration to fail and close channel, got %v", e)
+	}
+}
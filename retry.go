@@ -0,0 +1,213 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const RETRY_ATTEMPT_HEADER = "x-retry-attempt"
+// RETRY_ROUTE_HEADER has no "x-" prefix: headers exchange ignores such
+// headers on matching
+const RETRY_ROUTE_HEADER = "retry-route"
+
+func RetryExchangeName(queue string) string {
+	return queue + ".retry"
+}
+
+func RequeueExchangeName(queue string) string {
+	return queue + ".requeue"
+}
+
+// RetryQueueName contains delay in milliseconds: queue arguments can not
+// be changed, so changed ConfigRetry declares new delay queues
+func RetryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%d", queue, delay.Milliseconds())
+}
+
+func ParkingQueueName(queue string) string {
+	return queue + ".parked"
+}
+
+// Retry topology for origin queue "q":
+//
+//	q.retry    - headers exchange, routes by RETRY_ROUTE_HEADER
+//	q.retry.MS - delay queue with x-message-ttl of MS milliseconds,
+//	             dead-letters to q.requeue
+//	q.requeue  - fanout exchange bound to q, keeps original routing key
+//	q.parked   - queue for messages exceeded max attempts
+//
+// Delay queues of previous ConfigRetry are not used anymore
+// and may be deleted once they are empty
+type retrier struct {
+	cfg        ConfigRetry
+	queue      string
+	backoff    backoff
+
+	connection *Connection
+	channel    AMQPChannel // without connection topology is declared on it
+	publisher  *Publisher
+}
+
+// newRetrier publishes by pooled channels of connection,
+// otherwise by channel, which is used by subscriber
+func newRetrier(cfg ConfigRetry, queue string, connection *Connection, channel AMQPChannel) (*retrier, error) {
+	if queue == "" {
+		return nil, fmt.Errorf("%w: retry requires consumer queue", ErrorMissedQueueConfig)
+	}
+	if connection == nil && channel == nil {
+		return nil, ErrorRetryConnectionRequired
+	}
+	b, backoffError := newBackoff(cfg.Delay, cfg.MaxDelay, cfg.Multiplier)
+	if backoffError != nil {
+		return nil, backoffError
+	}
+	publisher := NewPublisher().ConfigPublisher(ConfigPublisher{
+		Exchange: RetryExchangeName(queue),
+		Mandatory: true,
+		Confirm: true,
+		ConfirmTimeout: DefaultConfigPublisher.ConfirmTimeout,
+	})
+	if connection != nil {
+		publisher.SetConnection(connection)
+	} else {
+		publisher.SetChannel(channel)
+	}
+	return &retrier{
+		cfg: cfg,
+		queue: queue,
+		backoff: b,
+		connection: connection,
+		channel: channel,
+		publisher: publisher,
+	}, nil
+}
+
+// Recover redeclares retry topology after reconnection
+func (this *retrier) Recover() error {
+	return this.declare()
+}
+
+func (this *retrier) declare() error {
+	channel := this.channel
+	if this.connection != nil {
+		// failed declaration must not close channel of subscriber
+		opened, channelError := this.connection.GetChannel()
+		if channelError != nil {
+			return channelError
+		}
+		defer this.connection.CloseChannel(opened)
+		channel = opened
+	}
+
+	exchanges := []ConfigExchange{
+		{Name: RetryExchangeName(this.queue), Type: amqp091.ExchangeHeaders, Durable: true},
+		{Name: RequeueExchangeName(this.queue), Type: amqp091.ExchangeFanout, Durable: true},
+	}
+	for _, cfg := range exchanges {
+		if e := NewExchange().ConfigExchange(cfg).SetChannel(channel).Declare(); e != nil {
+			return e
+		}
+	}
+
+	queues := []ConfigQueue{}
+	declared := map[string]bool{}
+	for attempt := 1; attempt <= this.cfg.MaxAttempts; attempt++ {
+		// attempts limited by MaxDelay share delay queue
+		delay := this.backoff.delay(attempt)
+		name := RetryQueueName(this.queue, delay)
+		if declared[name] {
+			continue
+		}
+		declared[name] = true
+		queues = append(queues, ConfigQueue{
+			Name: name,
+			Durable: true,
+			Args: map[string]interface{}{
+				"x-message-ttl": delay.Milliseconds(),
+				"x-dead-letter-exchange": RequeueExchangeName(this.queue),
+			},
+		})
+	}
+	queues = append(queues, ConfigQueue{Name: ParkingQueueName(this.queue), Durable: true})
+
+	for _, cfg := range queues {
+		if _, e := NewQueue(cfg).SetChannel(channel).Declare(); e != nil {
+			return e
+		}
+		binding := ConfigBinding{
+			Queue: cfg.Name,
+			Exchange: RetryExchangeName(this.queue),
+			Args: map[string]interface{}{
+				"x-match": "all",
+				RETRY_ROUTE_HEADER: cfg.Name,
+			},
+		}
+		if e := NewBinding().ConfigBinding(binding).SetChannel(channel).Declare(); e != nil {
+			return e
+		}
+	}
+
+	requeue := ConfigBinding{
+		Queue: this.queue,
+		Exchange: RequeueExchangeName(this.queue),
+	}
+	return NewBinding().ConfigBinding(requeue).SetChannel(channel).Declare()
+}
+
+// retry republishes failed delivery to the next delay queue
+// or parks it when attempts are exhausted
+func (this *retrier) retry(msg amqp091.Delivery) error {
+	attempt := RetryAttempt(msg) + 1
+
+	route := RetryQueueName(this.queue, this.backoff.delay(attempt))
+	if attempt > this.cfg.MaxAttempts {
+		route = ParkingQueueName(this.queue)
+	}
+
+	headers := amqp091.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	// tag of original publishing is meaningless for retry publisher
+	delete(headers, PUBLISH_TAG_HEADER)
+	headers[RETRY_ATTEMPT_HEADER] = int32(attempt)
+	headers[RETRY_ROUTE_HEADER] = route
+
+	return this.publisher.Publish(msg.Body, PubRoutingKey(msg.RoutingKey), func(p *Publish) {
+		p.Message = amqp091.Publishing{
+			Headers: headers,
+			ContentType: msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode: msg.DeliveryMode,
+			Priority: msg.Priority,
+			CorrelationId: msg.CorrelationId,
+			ReplyTo: msg.ReplyTo,
+			MessageId: msg.MessageId,
+			Timestamp: msg.Timestamp,
+			Type: msg.Type,
+			UserId: msg.UserId,
+			AppId: msg.AppId,
+			Body: msg.Body,
+		}
+	})
+}
+
+// RetryAttempt is the number of already made retries of the delivery
+func RetryAttempt(msg amqp091.Delivery) int {
+	switch attempt := msg.Headers[RETRY_ATTEMPT_HEADER].(type) {
+	case int:
+		return attempt
+	case int8:
+		return int(attempt)
+	case int16:
+		return int(attempt)
+	case int32:
+		return int(attempt)
+	case int64:
+		return int(attempt)
+	default:
+		return 0
+	}
+}
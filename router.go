@@ -0,0 +1,216 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type RouteDecoder func(msg []byte) (interface{}, error)
+type RouteConstructor func(key string, value interface{}) (ProcessableEntity, error)
+type RouteFallback func(key string, msg []byte) (ProcessableEntity, error)
+
+// DecodeJSON unmarshals message into value created by newValue
+func DecodeJSON(newValue func() interface{}) RouteDecoder {
+	return func(msg []byte) (interface{}, error) {
+		value := newValue()
+		if e := json.Unmarshal(msg, value); e != nil {
+			return nil, e
+		}
+		return value, nil
+	}
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Router is a DeliveryParser dispatching by routing key patterns,
+// the most specific matched pattern wins:
+// words are compared left to right, literal > "*" > "#",
+// then pattern with more non-"#" words, then fewer "#",
+// then earlier registered
+type Router struct {
+	routes   []route
+	index    *routingIndex // positions of routes in precedence order
+	fallback RouteFallback
+}
+
+type route struct {
+	pattern string
+	words   []string
+	parse   func(ctx context.Context, delivery Delivery) (ContextEntity, error)
+}
+
+func (this *Router) Route(pattern string, decode RouteDecoder, construct RouteConstructor) *Router {
+	return this.route(pattern, func(ctx context.Context, delivery Delivery) (ContextEntity, error) {
+		value, decodeError := decode(delivery.Body)
+		if decodeError != nil {
+			return nil, decodeError
+		}
+		entity, constructError := construct(delivery.RoutingKey, value)
+		if constructError != nil {
+			return nil, constructError
+		}
+		return EntityWithContext(entity), nil
+	})
+}
+
+func (this *Router) route(pattern string, parse func(context.Context, Delivery) (ContextEntity, error)) *Router {
+	this.routes = append(this.routes, route{
+		pattern: pattern,
+		words: splitWords(pattern),
+		parse: parse,
+	})
+	sort.SliceStable(this.routes, func(i, j int) bool {
+		return morePrecise(this.routes[i].words, this.routes[j].words)
+	})
+	this.index = &routingIndex{root: newRoutingNode(false)}
+	for pos, r := range this.routes {
+		this.index.add(r.pattern, pos)
+	}
+	return this
+}
+
+// Fallback handles routing keys without matched pattern
+// instead of ErrorUnprocessable
+func (this *Router) Fallback(fn RouteFallback) *Router {
+	this.fallback = fn
+	return this
+}
+
+func (this *Router) Match(key string) bool {
+	if this.fallback != nil {
+		return true
+	}
+	_, ok := this.find(key)
+	return ok
+}
+
+func (this *Router) Patterns() []string {
+	if this.fallback != nil {
+		return []string{HASH}
+	}
+	patterns := make([]string, len(this.routes))
+	for i, r := range this.routes {
+		patterns[i] = r.pattern
+	}
+	return patterns
+}
+
+func (this *Router) ParseDelivery(ctx context.Context, delivery Delivery) (ContextEntity, error) {
+	if r, ok := this.find(delivery.RoutingKey); ok {
+		return r.parse(ctx, delivery)
+	}
+	if this.fallback != nil {
+		entity, e := this.fallback(delivery.RoutingKey, delivery.Body)
+		if e != nil {
+			return nil, e
+		}
+		return EntityWithContext(entity), nil
+	}
+	return nil, ErrorUnprocessable
+}
+
+// find returns the first matched route, routes are sorted by precedence,
+// so the lowest matched position of index is the most precise one
+func (this *Router) find(key string) (route, bool) {
+	if this.index == nil {
+		return route{}, false
+	}
+	if pos := this.index.match(key); pos >= 0 {
+		return this.routes[pos], true
+	}
+	return route{}, false
+}
+
+// Validate reports duplicated patterns and patterns never matched
+// because of more precise ones, called by Subscriber on Listen
+func (this *Router) Validate() error {
+	errs := []error{}
+	for i, r := range this.routes {
+		for _, precise := range this.routes[:i] {
+			if precise.pattern == r.pattern {
+				errs = append(errs, fmt.Errorf("%w: %q", ErrorRouteDuplicate, r.pattern))
+				break
+			}
+			if coversPattern(precise.words, r.words) {
+				errs = append(errs, fmt.Errorf("%w: %q by %q", ErrorRouteShadowed, r.pattern, precise.pattern))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func wordRank(word string) int {
+	switch word {
+	case HASH:
+		return 0
+	case STAR:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func morePrecise(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ra, rb := wordRank(a[i]), wordRank(b[i]); ra != rb {
+			return ra > rb
+		}
+	}
+	ha, hb := countWord(a, HASH), countWord(b, HASH)
+	if wa, wb := len(a)-ha, len(b)-hb; wa != wb {
+		return wa > wb
+	}
+	return ha < hb
+}
+
+func countWord(words []string, word string) int {
+	count := 0
+	for _, w := range words {
+		if w == word {
+			count++
+		}
+	}
+	return count
+}
+
+// coversPattern is true when every routing key matched by b is matched by a,
+// may miss some exotic cases, but never reports false coverage
+func coversPattern(a, b []string) bool {
+	if len(a) == 0 {
+		return len(b) == 0
+	}
+	if a[0] == HASH {
+		return coversPattern(a[1:], b) || (len(b) > 0 && coversPattern(a, b[1:]))
+	}
+	if len(b) == 0 {
+		return false
+	}
+	if b[0] == HASH {
+		// "#" of b is either zero words or "*.#"
+		return coversPattern(a, b[1:]) && coversPattern(a, append([]string{STAR}, b...))
+	}
+	if a[0] == STAR || a[0] == b[0] {
+		return coversPattern(a[1:], b[1:])
+	}
+	return false
+}
+
+func validateParser(parser interface{}) error {
+	for parser != nil {
+		if v, ok := parser.(interface{ Validate() error }); ok {
+			return v.Validate()
+		}
+		w, ok := parser.(parserWrapper)
+		if !ok {
+			break
+		}
+		parser = w.unwrap()
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type routedEntity struct {
+	route string
+}
+
+func (this routedEntity) Process() error      { return nil }
+func (this routedEntity) EntityID() string    { return this.route }
+func (this routedEntity) MarkConflict() error { return nil }
+
+func routeTo(name string) RouteConstructor {
+	return func(key string, value interface{}) (ProcessableEntity, error) {
+		return routedEntity{name}, nil
+	}
+}
+
+func TestRouterPrecedence(t *testing.T) {
+	raw := func(msg []byte) (interface{}, error) { return msg, nil }
+	router := NewRouter().
+		Route("#", raw, routeTo("all")).
+		Route("change.#", raw, routeTo("changes")).
+		Route("*.user", raw, routeTo("users")).
+		Route("change.user", raw, routeTo("change-user")).
+		Route("change.*", raw, routeTo("change-any"))
+
+	if e := router.Validate(); e != nil {
+		t.Fatalf("Unexpected validation error: %s", e)
+	}
+
+	cases := map[string]string{
+		"change.user":       "change-user",
+		"change.group":      "change-any",
+		"change.user.group": "changes",
+		"delete.user":       "users",
+		"delete":            "all",
+	}
+	for key, expected := range cases {
+		entity, e := router.ParseDelivery(context.Background(), Delivery{RoutingKey: key})
+		if e != nil {
+			t.Errorf("Routing key(%s) unexpected error: %s", key, e)
+			continue
+		}
+		if id := entity.EntityID(); id != expected {
+			t.Errorf("Routing key(%s) expect route %s, got %s", key, expected, id)
+		}
+	}
+}
+
+func TestRouterValidate(t *testing.T) {
+	raw := func(msg []byte) (interface{}, error) { return msg, nil }
+	router := NewRouter().
+		Route("change.user", raw, routeTo("first")).
+		Route("change.user", raw, routeTo("second")).
+		Route("*.#", raw, routeTo("any")).
+		Route("#.user", raw, routeTo("shadowed")).
+		Route("change.#", raw, routeTo("changes")).
+		Route("change.#.#", raw, routeTo("shadowed-changes"))
+
+	e := router.Validate()
+	if count := len(e.(interface{ Unwrap() []error }).Unwrap()); count != 3 {
+		t.Errorf("Expect 3 aggregated errors, got %d: %s", count, e)
+	}
+	if !errors.Is(e, ErrorRouteDuplicate) {
+		t.Errorf("Expect duplicate error, got %v", e)
+	}
+	if !errors.Is(e, ErrorRouteShadowed) {
+		t.Errorf("Expect shadowed error, got %v", e)
+	}
+}
+
+func TestRouterFallback(t *testing.T) {
+	router := NewRouter()
+	if router.Match("change.user") {
+		t.Errorf("Expect empty router not to match")
+	}
+	if _, e := router.ParseDelivery(context.Background(), Delivery{RoutingKey: "change.user"}); e != ErrorUnprocessable {
+		t.Errorf("Expect unprocessable, got %v", e)
+	}
+
+	router.Fallback(func(key string, msg []byte) (ProcessableEntity, error) {
+		return routedEntity{"fallback"}, nil
+	})
+	entity, e := router.ParseDelivery(context.Background(), Delivery{RoutingKey: "change.user"})
+	if e != nil || entity.EntityID() != "fallback" {
+		t.Errorf("Expect fallback entity, got %v, %v", entity, e)
+	}
+}
@@ -0,0 +1,160 @@
+package rabbitmq
+
+// PatternParser exposes routing key patterns matched by parser, such parsers
+// are dispatched through routing index instead of calling Match one by one.
+// Match result must agree with MatchKey for any of the patterns.
+//
+// Only PatternParser (Router and parsers wrapping it included) is indexed,
+// other parsers fall back to linear scan: their Match is called for every
+// delivery when registered before the indexed match, so precedence by
+// registration order is kept for mixed parsers.
+type PatternParser interface {
+	Patterns() []string
+}
+
+// parser adapters expose wrapped parser
+type parserWrapper interface {
+	unwrap() interface{}
+}
+
+func patternsOf(parser interface{}) ([]string, bool) {
+	for parser != nil {
+		if p, ok := parser.(PatternParser); ok {
+			return p.Patterns(), true
+		}
+		w, ok := parser.(parserWrapper)
+		if !ok {
+			break
+		}
+		parser = w.unwrap()
+	}
+	return nil, false
+}
+
+// routingIndex is a trie over routing key words with "*" and "#" nodes,
+// lookup returns the first registered parser matching key,
+// Router indexes its routes by precedence positions
+type routingIndex struct {
+	root      *routingNode
+	parsers   []DeliveryParser
+	unindexed []int
+}
+
+type routingNode struct {
+	words   map[string]*routingNode
+	star    *routingNode
+	hash    *routingNode
+	isHash  bool  // consumes any number of words
+	parsers []int // registration positions of patterns ending here
+}
+
+func newRoutingNode(isHash bool) *routingNode {
+	return &routingNode{
+		words: make(map[string]*routingNode),
+		isHash: isHash,
+	}
+}
+
+func newRoutingIndex(parsers []DeliveryParser) *routingIndex {
+	index := &routingIndex{
+		root: newRoutingNode(false),
+		parsers: parsers,
+	}
+	for pos, p := range parsers {
+		patterns, ok := patternsOf(p)
+		if !ok {
+			index.unindexed = append(index.unindexed, pos)
+			continue
+		}
+		for _, pattern := range patterns {
+			index.add(pattern, pos)
+		}
+	}
+	return index
+}
+
+func (this *routingIndex) add(pattern string, pos int) {
+	node := this.root
+	for _, word := range splitWords(pattern) {
+		switch word {
+		case STAR:
+			if node.star == nil {
+				node.star = newRoutingNode(false)
+			}
+			node = node.star
+		case HASH:
+			if node.hash == nil {
+				node.hash = newRoutingNode(true)
+			}
+			node = node.hash
+		default:
+			if node.words[word] == nil {
+				node.words[word] = newRoutingNode(false)
+			}
+			node = node.words[word]
+		}
+	}
+	node.parsers = append(node.parsers, pos)
+}
+
+func (this *routingIndex) lookup(key string) (DeliveryParser, bool) {
+	found := this.match(key)
+
+	// parsers without patterns registered earlier take precedence
+	for _, pos := range this.unindexed {
+		if found >= 0 && pos > found {
+			break
+		}
+		if this.parsers[pos].Match(key) {
+			return this.parsers[pos], true
+		}
+	}
+
+	if found < 0 {
+		return nil, false
+	}
+	return this.parsers[found], true
+}
+
+// match returns the first position of indexed patterns matching key, -1 if none
+func (this *routingIndex) match(key string) int {
+	states := map[*routingNode]bool{}
+	this.enter(states, this.root)
+
+	for _, word := range splitWords(key) {
+		next := map[*routingNode]bool{}
+		for node := range states {
+			if node.isHash {
+				next[node] = true
+			}
+			if child := node.words[word]; child != nil {
+				this.enter(next, child)
+			}
+			if node.star != nil {
+				this.enter(next, node.star)
+			}
+		}
+		states = next
+		if len(states) == 0 {
+			break
+		}
+	}
+
+	found := -1
+	for node := range states {
+		for _, pos := range node.parsers {
+			if found < 0 || pos < found {
+				found = pos
+			}
+		}
+	}
+	return found
+}
+
+// enter adds node and "#" descendants matching zero words
+func (this *routingIndex) enter(states map[*routingNode]bool, node *routingNode) {
+	for node != nil && !states[node] {
+		states[node] = true
+		node = node.hash
+	}
+}
@@ -1,6 +1,14 @@
 package rabbitmq
 
-import "testing"
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fvaleriy89/rabbitmq/rabbitmqtest"
+)
 
 type routingKeyPairs struct {
 	n string // needle
@@ -19,6 +27,11 @@ func TestPositive(t *testing.T) {
 		{"*.user.#", "change.user.uss"},
 		{"#.user.*", "change.user.uss"},
 		{"change.#.uss.*", "change.user.420.uss.host1"},
+		{"change.user.#", "change.user"},
+		{"#", ""},
+		{"change..user", "change..user"},
+		{"change.*.user", "change..user"},
+		{"change.#", "change."},
 	}
 	for _, c := range cases {
 		if !MatchKey(c.n, c.s) {
@@ -32,8 +45,9 @@ func TestNegative(t *testing.T) {
 		{"change.user", "delete.user"},
 		{"change.user", "change.user.uss"},
 		{"change.user.*", "change.user"},
-		// TODO: move to positive!
-		{"change.user.#", "change.user"},
+		{"*", ""},
+		{"change.*", "change"},
+		{"change", "change."},
 	}
 	for _, c := range cases {
 		if MatchKey(c.n, c.s) {
@@ -41,3 +55,172 @@ func TestNegative(t *testing.T) {
 		}
 	}
 }
+
+// bindings and routes of rabbitmq-server topic matching test
+var brokerBindings = map[string]string{
+	"t1": "a.b.c", "t2": "a.*.c", "t3": "a.#.b", "t4": "a.b.b.c",
+	"t5": "#", "t6": "#.#", "t7": "#.b", "t8": "*.*",
+	"t9": "a.*", "t10": "*.b.c", "t11": "a.#", "t12": "a.#.#",
+	"t13": "b.b.c", "t14": "a.b.b", "t15": "a.b", "t16": "b.c",
+	"t17": "", "t18": "*.*.*", "t19": "vodka.martini", "t20": "a.b.c",
+	"t21": "*.#", "t22": "#.*.#", "t23": "*.#.#", "t24": "#.#.#",
+	"t25": "*", "t26": "#.b.#",
+}
+
+var brokerRoutes = map[string]string{
+	"a.b.c":               "t1 t2 t5 t6 t10 t11 t12 t18 t20 t21 t22 t23 t24 t26",
+	"a.b":                 "t3 t5 t6 t7 t8 t9 t11 t12 t15 t21 t22 t23 t24 t26",
+	"a.b.b":               "t3 t5 t6 t7 t11 t12 t14 t18 t21 t22 t23 t24 t26",
+	"":                    "t5 t6 t17 t24",
+	"b.c.c":               "t5 t6 t18 t21 t22 t23 t24 t26",
+	"a.a.a.a.a":           "t5 t6 t11 t12 t21 t22 t23 t24",
+	"vodka.gin":           "t5 t6 t8 t21 t22 t23 t24",
+	"vodka.martini":       "t5 t6 t8 t19 t21 t22 t23 t24",
+	"b.b.c":               "t5 t6 t10 t13 t18 t21 t22 t23 t24 t26",
+	"nothing.here.at.all": "t5 t6 t21 t22 t23 t24",
+	"oneword":             "t5 t6 t21 t22 t23 t24 t25",
+}
+
+func TestBrokerConformance(t *testing.T) {
+	for key, expected := range brokerRoutes {
+		matched := []string{}
+		for name, pattern := range brokerBindings {
+			if MatchKey(pattern, key) {
+				matched = append(matched, name)
+			}
+		}
+		if !sameNames(matched, strings.Fields(expected)) {
+			t.Errorf("Routing key(%s) expect %s, got %v", key, expected, matched)
+		}
+	}
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type patternParser struct {
+	name     string
+	patterns []string
+}
+
+func (this patternParser) Patterns() []string {
+	return this.patterns
+}
+
+func (this patternParser) Match(key string) bool {
+	for _, p := range this.patterns {
+		if MatchKey(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this patternParser) Parse(key string, msg []byte) (ProcessableEntity, error) {
+	return nil, nil
+}
+
+func TestRoutingIndex(t *testing.T) {
+	for name, pattern := range brokerBindings {
+		index := newRoutingIndex([]DeliveryParser{
+			ParserWithDelivery(ParserWithContext(patternParser{name, []string{pattern}})),
+		})
+		for key := range brokerRoutes {
+			_, found := index.lookup(key)
+			if expected := MatchKey(pattern, key); found != expected {
+				t.Errorf("Index of needle(%s) for routing key(%s) expect %v, got %v", pattern, key, expected, found)
+			}
+		}
+	}
+}
+
+type recordedEntity struct {
+	name      string
+	key       string
+	processed chan<- [2]string
+}
+
+func (this recordedEntity) Process() error {
+	this.processed <- [2]string{this.key, this.name}
+	return nil
+}
+func (this recordedEntity) EntityID() string { return this.key }
+func (this recordedEntity) MarkConflict() error { return nil }
+
+// recordingParser is dispatched through routing index
+type recordingParser struct {
+	patternParser
+	processed chan<- [2]string
+}
+
+func (this recordingParser) Parse(key string, msg []byte) (ProcessableEntity, error) {
+	return recordedEntity{this.name, key, this.processed}, nil
+}
+
+// plainParser without patterns is matched one by one
+type plainParser struct {
+	name      string
+	key       string
+	processed chan<- [2]string
+}
+
+func (this plainParser) Match(key string) bool {
+	return key == this.key
+}
+
+func (this plainParser) Parse(key string, msg []byte) (ProcessableEntity, error) {
+	return recordedEntity{this.name, key, this.processed}, nil
+}
+
+func TestRoutingIndexPrecedence(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	processed := make(chan [2]string, 10)
+	s := NewSubscriber().SetChannel(broker.Channel()).ConfigConsumer(ConfigConsumer{Count: 1, Queue: "users", Consumer: "users"})
+	e := s.Listen(
+		recordingParser{patternParser{"users", []string{"user.changed.*", "user.deleted.*"}}, processed},
+		plainParser{"plain", "user.plain", processed},
+		recordingParser{patternParser{"all", []string{"#"}}, processed},
+		recordingParser{patternParser{"unreachable", []string{"user.changed.uss"}}, processed},
+	)
+	if e != nil {
+		t.Fatalf("Unexpected listen error: %s", e)
+	}
+	defer s.Stop(context.Background())
+
+	cases := map[string]string{
+		"user.changed.uss": "users",
+		"user.deleted.uss": "users",
+		"user.plain":       "plain",
+		"user.created":     "all",
+	}
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	for key := range cases {
+		if e := publisher.Publish(nil, PubRoutingKey(key)); e != nil {
+			t.Fatalf("Unexpected publish error: %s", e)
+		}
+	}
+
+	for range cases {
+		select {
+		case p := <-processed:
+			if expected := cases[p[0]]; p[1] != expected {
+				t.Errorf("Routing key(%s) expect parser %s, got %s", p[0], expected, p[1])
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expect all messages to be processed")
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package rabbitmq
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 	"sync"
@@ -16,7 +18,9 @@ func NewSubscriber() *Subscriber {
 		configQos: DefaultConfigQos,
 		configConsumer: DefaultConfigConsumer,
 		configConflicts: DefaultConfigConflicts,
+		configRetry: DefaultConfigRetry,
 		resolver: NewConflictResolver(),
+		ackPolicy: DefaultAckPolicy,
 		errors: make(chan error, 1024),
 	}
 }
@@ -41,12 +45,23 @@ type Subscriber struct {
 	configQos          ConfigQos
 	configConsumer     ConfigConsumer
 	configConflicts    ConfigConflicts
+	configRetry        ConfigRetry
 
-	channel            *amqp091.Channel
+	channel            AMQPChannel
 	connection         *Connection
 	resolver           ConflictResolver // *resolver
-	parsers            []ProcessableParser
+	parsers            []DeliveryParser
+	index              *routingIndex
+	router             *Router // typed handlers
 	processingCallback processingCallback
+	ackPolicy          AckPolicy
+	retrier            *retrier
+	listening          bool
+	processors         sync.WaitGroup
+	stopping           chan struct{} // closed on Stop when consumers were not cancelled
+	ctx                context.Context // cancelled on Stop
+	cancel             context.CancelFunc
+	timeout            time.Duration
 
 	errors             chan error
 }
@@ -61,7 +76,7 @@ func (this *Subscriber) SetConnection(connection *Connection) *Subscriber {
 	return this
 }
 
-func (this *Subscriber) SetChannel(channel *amqp091.Channel) *Subscriber {
+func (this *Subscriber) SetChannel(channel AMQPChannel) *Subscriber {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	this.channel = channel
@@ -83,11 +98,37 @@ func (this *Subscriber) ConfigConflicts(cfg ConfigConflicts) *Subscriber {
 	return this
 }
 
+// Router collects typed handlers registered by Handle,
+// it is dispatched after parsers passed to Listen
+func (this *Subscriber) Router() *Router {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.router == nil {
+		this.router = NewRouter()
+	}
+	return this.router
+}
+
+// ConfigRetry enables republishing of failed entities to delay queues
+func (this *Subscriber) ConfigRetry(cfg ConfigRetry) *Subscriber {
+	this.configRetry = cfg
+	return this
+}
+
 func (this *Subscriber) PostProcessingCallback(f processingCallback) *Subscriber {
 	this.processingCallback = f
 	return this
 }
 
+// AckPolicy decides to ack, requeue or reject(dead-letter) processed message
+func (this *Subscriber) AckPolicy(policy AckPolicy) *Subscriber {
+	if policy == nil {
+		policy = DefaultAckPolicy
+	}
+	this.ackPolicy = policy
+	return this
+}
+
 func (this *Subscriber) UnresolvedLocksCallback(fn func(string)) error {
 	interval, e1 := time.ParseDuration(this.configConflicts.CheckIdleInterval)
 	if e1 != nil {
@@ -121,6 +162,10 @@ func (this *Subscriber) CheckLocks(errfn func(string), infofn func(string)) erro
 }
 
 func (this *Subscriber) Channel() (*amqp091.Channel, error) {
+	return concreteChannel(this.AMQPChannel())
+}
+
+func (this *Subscriber) AMQPChannel() (AMQPChannel, error) {
 	this.mx.Lock()
 	defer this.mx.Unlock()
 	if this.channel == nil {
@@ -131,6 +176,7 @@ func (this *Subscriber) Channel() (*amqp091.Channel, error) {
 		if channelError != nil {
 			return nil, channelError
 		}
+		this.connection.Register(this)
 		qosError := channel.Qos(
 			this.configQos.PrefetchCount,
 			this.configQos.PrefetchSize,
@@ -146,14 +192,162 @@ func (this *Subscriber) Channel() (*amqp091.Channel, error) {
 }
 
 func (s *Subscriber) Listen(parsers ...ProcessableParser) error {
-	s.parsers = parsers
+	contextParsers := make([]ContextParser, len(parsers))
+	for i, p := range parsers {
+		contextParsers[i] = ParserWithContext(p)
+	}
+	return s.ListenContext(contextParsers...)
+}
 
-	for i := 0; i < s.configConsumer.Count; i++ {
-		if e := s.consume(s.configConsumer.EnumConsumerTag(i)); e != nil {
+func (s *Subscriber) ListenContext(parsers ...ContextParser) error {
+	deliveryParsers := make([]DeliveryParser, len(parsers))
+	for i, p := range parsers {
+		deliveryParsers[i] = ParserWithDelivery(p)
+	}
+	return s.ListenDelivery(deliveryParsers...)
+}
+
+func (s *Subscriber) ListenDelivery(parsers ...DeliveryParser) error {
+	if s.router != nil {
+		parsers = append(parsers[:len(parsers):len(parsers)], s.router)
+	}
+
+	for _, p := range parsers {
+		if e := validateParser(p); e != nil {
 			return e
 		}
 	}
 
+	s.parsers = parsers
+	s.index = newRoutingIndex(parsers)
+
+	s.timeout = 0
+	if t := s.configConsumer.Timeout; t != "" {
+		timeout, timeoutError := time.ParseDuration(t)
+		if timeoutError != nil {
+			return timeoutError
+		}
+		s.timeout = timeout
+	}
+
+	s.mx.Lock()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.stopping = make(chan struct{})
+	s.mx.Unlock()
+
+	if e := s.declareRetry(); e != nil {
+		return e
+	}
+
+	if e := s.consumeAll(); e != nil {
+		return e
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.listening = true
+	return nil
+}
+
+// Stop cancels consumers, waits for in-flight messages to be processed
+// and acknowledged, then closes the channel even when cancel failed.
+// Handlers context is canceled when ctx expires before processing is finished
+func (this *Subscriber) Stop(ctx context.Context) error {
+	this.mx.Lock()
+	channel := this.channel
+	this.listening = false
+	cancel, stopping := this.cancel, this.stopping
+	this.stopping = nil
+	this.mx.Unlock()
+
+	if cancel != nil {
+		defer cancel()
+	}
+	if channel == nil {
+		return nil
+	}
+
+	// cancel errors are returned after draining and closing the channel
+	var errs []error
+	for i := 0; i < this.configConsumer.Count; i++ {
+		cfg := this.configConsumer.EnumConsumerTag(i)
+		if e := channel.Cancel(cfg.Consumer, cfg.NoWait); e != nil {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 && stopping != nil {
+		// consumers still deliver, processors quit after in-flight messages
+		close(stopping)
+	}
+
+	// handlers context is canceled (deferred) only after processors are
+	// done or ctx is expired, so in-flight messages are processed normally
+	done := make(chan struct{})
+	go func() {
+		this.processors.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.Join(append(errs, ctx.Err())...)
+	}
+
+	this.mx.Lock()
+	this.channel = nil
+	this.mx.Unlock()
+
+	if this.connection == nil {
+		errs = append(errs, channel.Close())
+	} else {
+		errs = append(errs, this.connection.CloseChannel(channel))
+	}
+	return errors.Join(errs...)
+}
+
+// Recover reopens channel and restarts consumers after reconnection
+func (this *Subscriber) Recover() error {
+	this.mx.Lock()
+	this.channel = nil
+	listening := this.listening
+	this.mx.Unlock()
+
+	if !listening {
+		return nil
+	}
+	return this.consumeAll()
+}
+
+func (this *Subscriber) declareRetry() error {
+	if !this.configRetry.Enabled || this.retrier != nil {
+		return nil
+	}
+	if _, e := this.AMQPChannel(); e != nil {
+		return e
+	}
+
+	this.mx.Lock()
+	connection, channel := this.connection, this.channel
+	this.mx.Unlock()
+
+	retrier, retrierError := newRetrier(this.configRetry, this.configConsumer.Queue, connection, channel)
+	if retrierError != nil {
+		return retrierError
+	}
+	if e := retrier.declare(); e != nil {
+		return e
+	}
+	connection.Register(retrier)
+	this.retrier = retrier
+	return nil
+}
+
+func (this *Subscriber) consumeAll() error {
+	for i := 0; i < this.configConsumer.Count; i++ {
+		if e := this.consume(this.configConsumer.EnumConsumerTag(i)); e != nil {
+			return e
+		}
+	}
 	return nil
 }
 
@@ -162,7 +356,7 @@ func (this *Subscriber) Wait() (<-chan error) {
 }
 
 func (this *Subscriber) consume(cfg ConfigConsumer) error {
-	channel, channelError := this.Channel()
+	channel, channelError := this.AMQPChannel()
 	if nil != channelError {
 		return channelError
 	}
@@ -171,7 +365,6 @@ func (this *Subscriber) consume(cfg ConfigConsumer) error {
 		return e
 	}
 
-	// TODO: channel.Cancel(cfg.Consumer, cfg.NoWait)
 	msgs, msgsError := channel.Consume(
 		cfg.Queue,
 		cfg.Consumer,
@@ -185,16 +378,36 @@ func (this *Subscriber) consume(cfg ConfigConsumer) error {
 		return msgsError
 	}
 
-	go this.processing(cfg, msgs)
+	this.mx.Lock()
+	stopping := this.stopping
+	this.mx.Unlock()
+
+	this.processors.Add(1)
+	go this.processing(cfg, msgs, stopping)
 
 	return nil
 }
 
-func (this *Subscriber) processing(cfg ConfigConsumer, msgs <-chan amqp091.Delivery) {
-	for msg := range msgs {
+func (this *Subscriber) processing(cfg ConfigConsumer, msgs <-chan amqp091.Delivery, stopping <-chan struct{}) {
+	defer this.processors.Done()
+
+	for {
+		var msg amqp091.Delivery
+		var ok bool
+		select {
+		case msg, ok = <-msgs:
+		case <-stopping:
+		}
+		if !ok {
+			break
+		}
+
+		delivery := NewDelivery(msg)
+		ctx, cancel := this.deliveryContext(delivery)
 		started := time.Now()
-		processingError := this.process(msg)
+		processingError := this.process(ctx, delivery)
 		processingDuration := time.Since(started)
+		cancel()
 
 		// TODO: WARNING_DURATION to config
 		if processingError == nil && processingDuration > WARNING_DURATION {
@@ -206,41 +419,70 @@ func (this *Subscriber) processing(cfg ConfigConsumer, msgs <-chan amqp091.Deliv
 		}
 
 		if !cfg.AutoAck {
-			msg.Ack(false) // non-multiple acknowledgement
+			ack := this.ackPolicy(msg, processingError)
+			if this.retrier != nil && errors.Is(processingError, ErrorProcessingFailed) {
+				// on failed retry fallback to policy decision
+				if e := this.retrier.retry(msg); e == nil {
+					ack = ACK
+				}
+			}
+			acknowledge(msg, ack)
 		}
 	}
 
-	this.errors <- fmt.Errorf(`Consumer "%s" finished processing`, cfg.Consumer)
+	this.mx.Lock()
+	stopped := !this.listening
+	this.mx.Unlock()
+	if !stopped {
+		// nobody may read errors anymore
+		select {
+		case this.errors <- fmt.Errorf(`Consumer "%s" finished processing`, cfg.Consumer):
+		default:
+		}
+	}
 }
 
-func (this *Subscriber) process(msg amqp091.Delivery) error {
-	entity, parsingError := this.parse(msg)
-	if parsingError != nil {
+func (this *Subscriber) deliveryContext(delivery Delivery) (context.Context, context.CancelFunc) {
+	this.mx.Lock()
+	ctx := this.ctx
+	this.mx.Unlock()
+
+	ctx = withDelivery(ctx, delivery)
+	if this.timeout > 0 {
+		return context.WithTimeout(ctx, this.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (this *Subscriber) process(ctx context.Context, delivery Delivery) error {
+	entity, parsingError := this.parse(ctx, delivery)
+	if parsingError == ErrorUnprocessable {
 		return parsingError
 	}
+	if parsingError != nil {
+		return fmt.Errorf("%w: %w", ErrorParsingFailed, parsingError)
+	}
 
 	if this.configConflicts.Enabled {
-		eid, conflict := this.resolver.Enter(entity.EntityID(), msg.DeliveryTag)
+		eid, conflict := this.resolver.Enter(entity.EntityID(), delivery.DeliveryTag)
 		defer this.resolver.Leave(entity.EntityID(), eid)
 		if conflict {
 			if e := entity.MarkConflict(); e != nil {
-				return e
+				return fmt.Errorf("%w: %w", ErrorProcessingFailed, e)
 			}
 		}
 	}
 
-	if e := entity.Process(); e != nil {
-		return e
+	if e := entity.ProcessContext(ctx); e != nil {
+		return fmt.Errorf("%w: %w", ErrorProcessingFailed, e)
 	}
 
 	return nil
 }
 
-func (this *Subscriber) parse(msg amqp091.Delivery) (ProcessableEntity, error) {
-	for _, p := range this.parsers {
-		if p.Match(msg.RoutingKey) {
-			return p.Parse(msg.RoutingKey, msg.Body)
-		}
+func (this *Subscriber) parse(ctx context.Context, delivery Delivery) (ContextEntity, error) {
+	if p, ok := this.index.lookup(delivery.RoutingKey); ok {
+		return p.ParseDelivery(ctx, delivery)
 	}
 	return nil, ErrorUnprocessable
 }
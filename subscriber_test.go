@@ -0,0 +1,251 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fvaleriy89/rabbitmq/rabbitmqtest"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestSubscriberAcknowledgement(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	mx := sync.Mutex{}
+	attempts := map[string]int{}
+	processed := make(chan string, 10)
+	s := Handle(NewSubscriber(), "user.*", func(ctx context.Context, u userChanged, d Delivery) error {
+		mx.Lock()
+		attempts[u.ID]++
+		mx.Unlock()
+		if u.Name == "broken" || !d.Redelivered {
+			return errors.New("failed")
+		}
+		processed <- u.ID
+		return nil
+	})
+	s.SetChannel(broker.Channel()).ConfigConsumer(ConfigConsumer{Count: 1, Queue: "users", Consumer: "users"})
+	if e := s.ListenDelivery(); e != nil {
+		t.Fatalf("Unexpected listen error: %s", e)
+	}
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	publisher.PublishValue(userChanged{ID: "1", Name: "uss"}, PubRoutingKey("user.changed"))
+	publisher.PublishValue(userChanged{ID: "2", Name: "broken"}, PubRoutingKey("user.changed"))
+
+	select {
+	case id := <-processed:
+		if id != "1" {
+			t.Errorf("Expect processed user 1, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Message was not processed")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(broker.Messages("users.dead")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if dead := broker.Messages("users.dead"); len(dead) != 1 || dead[0].RoutingKey != "user.changed" {
+		t.Errorf("Expect broken message to be dead-lettered, got %+v", dead)
+	}
+
+	if e := s.Stop(context.Background()); e != nil {
+		t.Errorf("Unexpected stop error: %s", e)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if attempts["1"] != 2 || attempts["2"] != 2 {
+		t.Errorf("Expect two attempts of each message, got %v", attempts)
+	}
+}
+
+func TestSubscriberStopDrains(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	results := make(chan error, 2)
+	s := Handle(NewSubscriber(), "user.*", func(ctx context.Context, u userChanged, d Delivery) error {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		results <- ctx.Err()
+		return nil
+	})
+	s.SetChannel(broker.Channel()).ConfigConsumer(ConfigConsumer{Count: 1, Queue: "users", Consumer: "users"})
+	if e := s.ListenDelivery(); e != nil {
+		t.Fatalf("Unexpected listen error: %s", e)
+	}
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	publisher.PublishValue(userChanged{ID: "1"}, PubRoutingKey("user.changed"))
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.Stop(context.Background())
+	}()
+	select {
+	case e := <-stopped:
+		t.Fatalf("Expect Stop to wait for in-flight message, got %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if e := <-results; e != nil {
+		t.Errorf("Expect in-flight message to be processed with live context, got %s", e)
+	}
+	if e := <-stopped; e != nil {
+		t.Errorf("Unexpected stop error: %s", e)
+	}
+}
+
+// cancelFailedChannel fails to cancel consumers
+type cancelFailedChannel struct {
+	*rabbitmqtest.Channel
+}
+
+func (this cancelFailedChannel) Cancel(consumer string, noWait bool) error {
+	return errors.New("cancel failed")
+}
+
+func TestSubscriberStopCancelFailed(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	processed := make(chan struct{})
+	s := Handle(NewSubscriber(), "user.*", func(ctx context.Context, u userChanged, d Delivery) error {
+		started <- struct{}{}
+		<-release
+		close(processed)
+		return nil
+	})
+	channel := cancelFailedChannel{broker.Channel()}
+	s.SetChannel(channel).ConfigConsumer(ConfigConsumer{Count: 1, Queue: "users", Consumer: "users"})
+	if e := s.ListenDelivery(); e != nil {
+		t.Fatalf("Unexpected listen error: %s", e)
+	}
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	publisher.PublishValue(userChanged{ID: "1"}, PubRoutingKey("user.changed"))
+	<-started
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	e := s.Stop(context.Background())
+	select {
+	case <-processed:
+	default:
+		t.Errorf("Expect Stop to wait for in-flight message despite cancel error")
+	}
+	if e == nil || e.Error() != "cancel failed" {
+		t.Errorf("Expect cancel error, got %v", e)
+	}
+	if !channel.IsClosed() {
+		t.Errorf("Expect channel to be closed despite cancel error")
+	}
+}
+
+func TestSubscriberStopTimeout(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	started := make(chan struct{}, 1)
+	results := make(chan error, 1)
+	s := Handle(NewSubscriber(), "user.*", func(ctx context.Context, u userChanged, d Delivery) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		results <- ctx.Err()
+		return nil
+	})
+	s.SetChannel(broker.Channel()).ConfigConsumer(ConfigConsumer{Count: 1, Queue: "users", Consumer: "users"})
+	if e := s.ListenDelivery(); e != nil {
+		t.Fatalf("Unexpected listen error: %s", e)
+	}
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	publisher.PublishValue(userChanged{ID: "1"}, PubRoutingKey("user.changed"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if e := s.Stop(ctx); !errors.Is(e, context.DeadlineExceeded) {
+		t.Errorf("Expect stop timeout, got %v", e)
+	}
+	select {
+	case e := <-results:
+		if !errors.Is(e, context.Canceled) {
+			t.Errorf("Expect handler context to be canceled, got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expect handler context to be canceled after stop timeout")
+	}
+}
+
+func TestSubscriberRetry(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	attempts := make(chan int, 10)
+	s := Handle(NewSubscriber(), "user.*", func(ctx context.Context, u userChanged, d Delivery) error {
+		attempt := RetryAttempt(amqp091.Delivery{Headers: d.Headers})
+		attempts <- attempt
+		if attempt < 2 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	// retry without connection declares and publishes on subscriber channel
+	s.SetChannel(broker.Channel()).
+		ConfigConsumer(ConfigConsumer{Count: 1, Queue: "users", Consumer: "users"}).
+		ConfigRetry(ConfigRetry{Enabled: true, MaxAttempts: 3, Delay: "10ms", MaxDelay: "20ms", Multiplier: 2})
+	if e := s.ListenDelivery(); e != nil {
+		t.Fatalf("Unexpected listen error: %s", e)
+	}
+	defer s.Stop(context.Background())
+
+	publisher := NewPublisher().SetChannel(broker.Channel()).ConfigPublisher(ConfigPublisher{Exchange: "events"})
+	publisher.PublishValue(userChanged{ID: "1"}, PubRoutingKey("user.changed"))
+
+	for expected := 0; expected <= 2; expected++ {
+		select {
+		case attempt := <-attempts:
+			if attempt != expected {
+				t.Fatalf("Expect attempt %d, got %d", expected, attempt)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expect attempt %d", expected)
+		}
+	}
+
+	// attempts limited by MaxDelay share delay queue
+	for _, queue := range []string{RetryQueueName("users", 10*time.Millisecond), RetryQueueName("users", 20*time.Millisecond)} {
+		if _, e := broker.Channel().QueueInspect(queue); e != nil {
+			t.Errorf("Expect delay queue %s, got %s", queue, e)
+		}
+	}
+	if _, e := broker.Channel().QueueInspect(RetryQueueName("users", 40*time.Millisecond)); e == nil {
+		t.Errorf("Expect delay above MaxDelay not to be declared")
+	}
+}
+
+func TestRetrierRequirements(t *testing.T) {
+	if _, e := newRetrier(DefaultConfigRetry, "", NewConnection(DefaultConfigConnection), nil); !errors.Is(e, ErrorMissedQueueConfig) {
+		t.Errorf("Expect ErrorMissedQueueConfig, got %v", e)
+	}
+	if _, e := newRetrier(DefaultConfigRetry, "users", nil, nil); !errors.Is(e, ErrorRetryConnectionRequired) {
+		t.Errorf("Expect ErrorRetryConnectionRequired, got %v", e)
+	}
+}
@@ -0,0 +1,69 @@
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// TLSConfig loads CA and client certificate files,
+// nil config is returned when TLS is disabled
+func (c ConfigTLS) TLSConfig() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName: c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		ca, readError := os.ReadFile(c.CAFile)
+		if readError != nil {
+			return nil, readError
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("%w: %s", ErrorInvalidCA, c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, certificateError := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if certificateError != nil {
+			return nil, certificateError
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+const DEFAULT_HEARTBEAT = 10 * time.Second
+const DEFAULT_LOCALE = "en_US"
+
+// AMQPConfig of amqp091.DialConfig with TLS and SASL mechanism,
+// credentials and vhost are taken from Url, defaults are as of amqp091.Dial
+func (c ConfigConnection) AMQPConfig() (amqp091.Config, error) {
+	config := amqp091.Config{
+		Heartbeat: DEFAULT_HEARTBEAT,
+		Locale: DEFAULT_LOCALE,
+	}
+
+	tlsConfig, tlsError := c.TLS.TLSConfig()
+	if tlsError != nil {
+		return config, tlsError
+	}
+	config.TLSClientConfig = tlsConfig
+
+	switch c.Auth {
+	case "", AUTH_PLAIN:
+	case AUTH_EXTERNAL:
+		config.SASL = []amqp091.Authentication{&amqp091.ExternalAuth{}}
+	default:
+		return config, fmt.Errorf("%w: %q", ErrorUnknownAuth, c.Auth)
+	}
+	return config, nil
+}
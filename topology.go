@@ -0,0 +1,314 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func NewTopology(cfg ConfigTopology) *Topology {
+	return (&Topology{
+		configConnection: DefaultConfigConnection,
+	}).ConfigTopology(cfg)
+}
+
+// ParseTopology decodes JSON document, omitted fields of exchanges,
+// queues and bindings take values of DefaultConfig* variables
+func ParseTopology(data []byte) (*Topology, error) {
+	var raw struct {
+		Exchanges []json.RawMessage `json:"exchanges"`
+		Queues    []json.RawMessage `json:"queues"`
+		Bindings  []json.RawMessage `json:"bindings"`
+	}
+	if e := json.Unmarshal(data, &raw); e != nil {
+		return nil, e
+	}
+
+	cfg := ConfigTopology{}
+	for _, r := range raw.Exchanges {
+		exchange := DefaultConfigExchange
+		if e := json.Unmarshal(r, &exchange); e != nil {
+			return nil, e
+		}
+		exchange.Args = integralArgs(exchange.Args)
+		cfg.Exchanges = append(cfg.Exchanges, exchange)
+	}
+	for _, r := range raw.Queues {
+		queue := DefaultConfigQueue
+		if e := json.Unmarshal(r, &queue); e != nil {
+			return nil, e
+		}
+		queue.Args = integralArgs(queue.Args)
+		cfg.Queues = append(cfg.Queues, queue)
+	}
+	for _, r := range raw.Bindings {
+		binding := DefaultConfigBinding
+		if e := json.Unmarshal(r, &binding); e != nil {
+			return nil, e
+		}
+		binding.Args = integralArgs(binding.Args)
+		cfg.Bindings = append(cfg.Bindings, binding)
+	}
+	return NewTopology(cfg), nil
+}
+
+func LoadTopology(r io.Reader) (*Topology, error) {
+	data, e := io.ReadAll(r)
+	if e != nil {
+		return nil, e
+	}
+	return ParseTopology(data)
+}
+
+// Topology declares exchanges, queues and bindings on a single channel
+type Topology struct {
+	mx               sync.Mutex
+
+	configConnection ConfigConnection
+	configTopology   ConfigTopology
+
+	connection       *Connection
+	channel          AMQPChannel
+	provided         bool // channel of SetChannel is never replaced
+	declared         bool
+}
+
+func (this *Topology) ConfigConnection(cfg ConfigConnection) *Topology {
+	this.configConnection = cfg
+	return this
+}
+
+func (this *Topology) ConfigTopology(cfg ConfigTopology) *Topology {
+	this.configTopology = cfg
+	return this
+}
+
+func (this *Topology) SetConnection(connection *Connection) *Topology {
+	this.connection = connection
+	return this
+}
+
+// SetChannel declares topology on given channel, when broker closes it
+// remaining declarations fail by ErrorChannelClosed
+func (this *Topology) SetChannel(channel AMQPChannel) *Topology {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.channel = channel
+	this.provided = channel != nil
+	return this
+}
+
+func (this *Topology) Channel() (*amqp091.Channel, error) {
+	return concreteChannel(this.AMQPChannel())
+}
+
+func (this *Topology) AMQPChannel() (AMQPChannel, error) {
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	if this.provided {
+		if this.channel.IsClosed() {
+			return nil, ErrorChannelClosed
+		}
+		return this.channel, nil
+	}
+	if this.channel == nil {
+		if this.connection == nil {
+			this.connection = NewConnection(this.configConnection)
+		}
+		channel, channelError := this.connection.GetChannel()
+		if channelError != nil {
+			return nil, channelError
+		}
+		this.connection.Register(this)
+		this.channel = channel
+	}
+	return this.channel, nil
+}
+
+// Validate checks names, exchange types and references of bindings,
+// all found problems are reported at once
+func (this *Topology) Validate() error {
+	errs := []error{}
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]interface{}{ErrorInvalidTopology}, args...)...))
+	}
+
+	exchanges := map[string]bool{}
+	for _, cfg := range this.configTopology.Exchanges {
+		switch {
+		case cfg.Name == "":
+			invalid("exchange without name")
+		case strings.HasPrefix(cfg.Name, "amq.") && !cfg.Passive:
+			invalid("exchange %q uses reserved prefix amq.", cfg.Name)
+		case exchanges[cfg.Name]:
+			invalid("exchange %q declared twice", cfg.Name)
+		}
+		switch cfg.Type {
+		case amqp091.ExchangeDirect, amqp091.ExchangeFanout, amqp091.ExchangeTopic, amqp091.ExchangeHeaders:
+		default:
+			if !strings.HasPrefix(cfg.Type, "x-") {
+				invalid("exchange %q has unknown type %q", cfg.Name, cfg.Type)
+			}
+		}
+		if e := amqp091.Table(cfg.Args).Validate(); e != nil {
+			invalid("exchange %q args: %s", cfg.Name, e)
+		}
+		exchanges[cfg.Name] = true
+	}
+
+	queues := map[string]bool{}
+	for _, cfg := range this.configTopology.Queues {
+		switch {
+		case cfg.Name == "":
+			invalid("queue without name")
+		case queues[cfg.Name]:
+			invalid("queue %q declared twice", cfg.Name)
+		}
+		if e := amqp091.Table(cfg.Args).Validate(); e != nil {
+			invalid("queue %q args: %s", cfg.Name, e)
+		}
+		queues[cfg.Name] = true
+	}
+
+	for _, cfg := range this.configTopology.Bindings {
+		if !queues[cfg.Queue] {
+			invalid("binding %s refers to undeclared queue", bindingName(cfg))
+		}
+		if !exchanges[cfg.Exchange] && !strings.HasPrefix(cfg.Exchange, "amq.") {
+			invalid("binding %s refers to undeclared exchange", bindingName(cfg))
+		}
+		if e := amqp091.Table(cfg.Args).Validate(); e != nil {
+			invalid("binding %s args: %s", bindingName(cfg), e)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Declare validates topology and declares exchanges, queues, then bindings;
+// failed declaration skips dependent bindings, errors are aggregated
+func (this *Topology) Declare() error {
+	if e := this.Validate(); e != nil {
+		return e
+	}
+
+	errs := []error{}
+	failed := map[string]bool{}
+
+	for _, cfg := range this.configTopology.Exchanges {
+		channel, channelError := this.AMQPChannel()
+		if channelError == ErrorChannelClosed {
+			errs = append(errs, fmt.Errorf("exchange %q: %w", cfg.Name, channelError))
+			failed["exchange:"+cfg.Name] = true
+			continue
+		}
+		if channelError != nil {
+			return errors.Join(append(errs, channelError)...)
+		}
+		if e := NewExchange().ConfigExchange(cfg).SetChannel(channel).Declare(); e != nil {
+			errs = append(errs, fmt.Errorf("exchange %q: %w", cfg.Name, e))
+			failed["exchange:"+cfg.Name] = true
+			this.dropClosedChannel(channel)
+		}
+	}
+
+	for _, cfg := range this.configTopology.Queues {
+		channel, channelError := this.AMQPChannel()
+		if channelError == ErrorChannelClosed {
+			errs = append(errs, fmt.Errorf("queue %q: %w", cfg.Name, channelError))
+			failed["queue:"+cfg.Name] = true
+			continue
+		}
+		if channelError != nil {
+			return errors.Join(append(errs, channelError)...)
+		}
+		if _, e := NewQueue(cfg).SetChannel(channel).Declare(); e != nil {
+			errs = append(errs, fmt.Errorf("queue %q: %w", cfg.Name, e))
+			failed["queue:"+cfg.Name] = true
+			this.dropClosedChannel(channel)
+		}
+	}
+
+	for _, cfg := range this.configTopology.Bindings {
+		if failed["queue:"+cfg.Queue] || failed["exchange:"+cfg.Exchange] {
+			errs = append(errs, fmt.Errorf("binding %s: skipped", bindingName(cfg)))
+			continue
+		}
+		channel, channelError := this.AMQPChannel()
+		if channelError == ErrorChannelClosed {
+			errs = append(errs, fmt.Errorf("binding %s: %w", bindingName(cfg), channelError))
+			continue
+		}
+		if channelError != nil {
+			return errors.Join(append(errs, channelError)...)
+		}
+		if e := NewBinding().ConfigBinding(cfg).SetChannel(channel).Declare(); e != nil {
+			errs = append(errs, fmt.Errorf("binding %s: %w", bindingName(cfg), e))
+			this.dropClosedChannel(channel)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	this.mx.Lock()
+	defer this.mx.Unlock()
+	this.declared = true
+	return nil
+}
+
+// broker closes channel on failed declaration, own channel is released
+// to connection and reopened, provided one is kept to report ErrorChannelClosed
+func (this *Topology) dropClosedChannel(channel AMQPChannel) {
+	if !channel.IsClosed() {
+		return
+	}
+	this.mx.Lock()
+	own := this.channel == channel && !this.provided
+	if own {
+		this.channel = nil
+	}
+	connection := this.connection
+	this.mx.Unlock()
+
+	if own && connection != nil {
+		connection.CloseChannel(channel)
+	}
+}
+
+// Recover reopens own channel and redeclares topology after reconnection
+func (this *Topology) Recover() error {
+	this.mx.Lock()
+	if !this.provided {
+		this.channel = nil
+	}
+	declared := this.declared
+	this.mx.Unlock()
+
+	if !declared {
+		return nil
+	}
+	return this.Declare()
+}
+
+// JSON numbers are decoded as float64, but broker expects integer
+// values for arguments like x-message-ttl or x-max-length
+func integralArgs(args map[string]interface{}) map[string]interface{} {
+	for k, v := range args {
+		if f, ok := v.(float64); ok && f == math.Trunc(f) {
+			args[k] = int64(f)
+		}
+	}
+	return args
+}
+
+func bindingName(cfg ConfigBinding) string {
+	return fmt.Sprintf("%q -[%s]-> %q", cfg.Exchange, cfg.RoutingKey, cfg.Queue)
+}
@@ -0,0 +1,167 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fvaleriy89/rabbitmq/rabbitmqtest"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestParseTopology(t *testing.T) {
+	topology, e := ParseTopology([]byte(`{
+		"exchanges": [{"name": "events"}],
+		"queues": [{"name": "users", "args": {"x-message-ttl": 60000}}],
+		"bindings": [{"queue": "users", "exchange": "events", "routing-key": "user.#"}]
+	}`))
+	if e != nil {
+		t.Fatalf("Unexpected parse error: %s", e)
+	}
+	if e := topology.Validate(); e != nil {
+		t.Errorf("Unexpected validation error: %s", e)
+	}
+
+	exchange := topology.configTopology.Exchanges[0]
+	if exchange.Type != DefaultConfigExchange.Type || !exchange.Durable {
+		t.Errorf("Expect default exchange fields, got %+v", exchange)
+	}
+	queue := topology.configTopology.Queues[0]
+	if !queue.Durable {
+		t.Errorf("Expect default queue fields, got %+v", queue)
+	}
+	if ttl, ok := queue.Args["x-message-ttl"].(int64); !ok || ttl != 60000 {
+		t.Errorf("Expect integer x-message-ttl, got %#v", queue.Args["x-message-ttl"])
+	}
+}
+
+func TestValidateTopology(t *testing.T) {
+	topology := NewTopology(ConfigTopology{
+		Exchanges: []ConfigExchange{
+			{Name: "events", Type: "topic"},
+			{Name: "events", Type: "unknown"},
+		},
+		Queues: []ConfigQueue{
+			{Name: ""},
+		},
+		Bindings: []ConfigBinding{
+			{Queue: "users", Exchange: "missed"},
+			{Queue: "users", Exchange: "amq.topic"},
+		},
+	})
+
+	e := topology.Validate()
+	if !errors.Is(e, ErrorInvalidTopology) {
+		t.Fatalf("Expect invalid topology, got %v", e)
+	}
+
+	// duplicate, unknown type, unnamed queue, 2 missed queues, missed exchange
+	if count := len(e.(interface{ Unwrap() []error }).Unwrap()); count != 6 {
+		t.Errorf("Expect 6 aggregated errors, got %d: %s", count, e)
+	}
+}
+
+func TestDeclareProvidedChannel(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	if e := broker.Channel().ExchangeDeclare("events", amqp091.ExchangeTopic, true, false, false, false, nil); e != nil {
+		t.Fatalf("Unexpected declaration error: %s", e)
+	}
+
+	channel := broker.Channel()
+	topology := NewTopology(ConfigTopology{
+		Exchanges: []ConfigExchange{
+			{Name: "events", Type: amqp091.ExchangeFanout, Durable: true},
+			{Name: "dead", Type: amqp091.ExchangeFanout, Durable: true},
+		},
+		Queues: []ConfigQueue{
+			{Name: "users", Durable: true},
+		},
+		Bindings: []ConfigBinding{
+			{Queue: "users", Exchange: "dead"},
+		},
+	}).SetChannel(channel)
+
+	// inequivalent exchange closes channel, default connection is not dialed
+	e := topology.Declare()
+	if !errors.Is(e, ErrorChannelClosed) {
+		t.Fatalf("Expect ErrorChannelClosed, got %v", e)
+	}
+	if count := len(e.(interface{ Unwrap() []error }).Unwrap()); count != 4 {
+		t.Errorf("Expect 4 aggregated errors, got %d: %s", count, e)
+	}
+	if provided, _ := topology.AMQPChannel(); provided != nil {
+		t.Errorf("Expect closed channel not to be replaced, got %v", provided)
+	}
+}
+
+// declareChannel records declaration methods called on it
+type declareChannel struct {
+	*rabbitmqtest.Channel
+	called *[]string
+}
+
+func (this declareChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error {
+	*this.called = append(*this.called, "ExchangeDeclare")
+	return this.Channel.ExchangeDeclare(name, kind, durable, autoDelete, internal, noWait, args)
+}
+
+func (this declareChannel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error {
+	*this.called = append(*this.called, "ExchangeDeclarePassive")
+	return this.Channel.ExchangeDeclarePassive(name, kind, durable, autoDelete, internal, noWait, args)
+}
+
+func (this declareChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error) {
+	*this.called = append(*this.called, "QueueDeclare")
+	return this.Channel.QueueDeclare(name, durable, autoDelete, exclusive, noWait, args)
+}
+
+func (this declareChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error) {
+	*this.called = append(*this.called, "QueueDeclarePassive")
+	return this.Channel.QueueDeclarePassive(name, durable, autoDelete, exclusive, noWait, args)
+}
+
+func TestPassiveDeclaration(t *testing.T) {
+	broker := rabbitmqtest.NewBroker()
+	fakeTopology(t, broker)
+
+	cases := []struct {
+		name     string
+		declare  func(channel AMQPChannel) error
+		expected string
+		missing  bool
+	}{
+		{"exchange", func(channel AMQPChannel) error {
+			return NewExchange().SetChannel(channel).ConfigExchange(ConfigExchange{Name: "events", Type: amqp091.ExchangeTopic, Durable: true}).Declare()
+		}, "ExchangeDeclare", false},
+		{"passive exchange", func(channel AMQPChannel) error {
+			return NewExchange().SetChannel(channel).ConfigExchange(ConfigExchange{Name: "events", Type: amqp091.ExchangeTopic, Durable: true, Passive: true}).Declare()
+		}, "ExchangeDeclarePassive", false},
+		{"missing passive exchange", func(channel AMQPChannel) error {
+			return NewExchange().SetChannel(channel).ConfigExchange(ConfigExchange{Name: "orders", Type: amqp091.ExchangeTopic, Passive: true}).Declare()
+		}, "ExchangeDeclarePassive", true},
+		{"queue", func(channel AMQPChannel) error {
+			_, e := NewQueue(ConfigQueue{Name: "users.dead", Durable: true}).SetChannel(channel).Declare()
+			return e
+		}, "QueueDeclare", false},
+		{"passive queue", func(channel AMQPChannel) error {
+			_, e := NewQueue(ConfigQueue{Name: "users", Passive: true}).SetChannel(channel).Declare()
+			return e
+		}, "QueueDeclarePassive", false},
+		{"missing passive queue", func(channel AMQPChannel) error {
+			_, e := NewQueue(ConfigQueue{Name: "orders", Passive: true}).SetChannel(channel).Declare()
+			return e
+		}, "QueueDeclarePassive", true},
+	}
+	for _, c := range cases {
+		called := []string{}
+		e := c.declare(declareChannel{broker.Channel(), &called})
+		if len(called) != 1 || called[0] != c.expected {
+			t.Errorf("Declaration of %s expect %s, called %v", c.name, c.expected, called)
+		}
+		if c.missing != errors.Is(e, ErrorPassiveDeclaration) {
+			t.Errorf("Declaration of %s got %v", c.name, e)
+		}
+		if !c.missing && e != nil {
+			t.Errorf("Unexpected declaration error of %s: %s", c.name, e)
+		}
+	}
+}